@@ -16,6 +16,7 @@ kubectl delete deployment service-auth-admin --ignore-not-found=true
 kubectl delete deployment postgres-laporan --ignore-not-found=true
 kubectl delete deployment postgres-warga --ignore-not-found=true
 kubectl delete deployment postgres-admin --ignore-not-found=true
+kubectl delete deployment minio --ignore-not-found=true
 
 # Delete only Laporan system services
 echo "Removing Laporan system services..."
@@ -28,6 +29,7 @@ kubectl delete service service-auth-admin --ignore-not-found=true
 kubectl delete service postgres-laporan --ignore-not-found=true
 kubectl delete service postgres-warga --ignore-not-found=true
 kubectl delete service postgres-admin --ignore-not-found=true
+kubectl delete service minio --ignore-not-found=true
 
 # Delete only Laporan system configmaps
 echo "Removing Laporan system configmaps..."
@@ -38,6 +40,11 @@ kubectl delete configmap jwt-config --ignore-not-found=true
 kubectl delete configmap warga-db-init --ignore-not-found=true
 kubectl delete configmap admin-db-init --ignore-not-found=true
 kubectl delete configmap laporan-db-init --ignore-not-found=true
+kubectl delete configmap attachment-storage-config --ignore-not-found=true
+kubectl delete configmap pembuat-laporan-config --ignore-not-found=true
+kubectl delete configmap anon-token-config --ignore-not-found=true
+kubectl delete configmap anon-token-public-key --ignore-not-found=true
+# The anon-token-keys and vapid-keys Secrets are kept on purpose; delete them by hand to rotate the keys
 
 # Delete only Laporan system HPA
 echo "Removing Laporan system HPA..."
@@ -48,6 +55,7 @@ echo "Removing Laporan system ingress..."
 kubectl delete ingress laporan-system-ingress --ignore-not-found=true
 kubectl delete ingress laporan-root-ingress --ignore-not-found=true
 kubectl delete ingress laporan-api-ingress --ignore-not-found=true
+kubectl delete ingress laporan-anonim-ingress --ignore-not-found=true
 
 echo ""
 echo "Waiting for resources to be deleted..."
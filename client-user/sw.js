@@ -0,0 +1,15 @@
+// Service worker for Web Push notifications about the user's own reports.
+// The payload is a PushMessage from service-pembuat-laporan (push.go).
+self.addEventListener('push', (event) => {
+    const message = event.data ? event.data.json() : {};
+    event.waitUntil(self.registration.showNotification(message.title || 'Laporan Warga', {
+        body: message.body || '',
+        tag: message.laporan_id ? `laporan-${message.laporan_id}` : undefined,
+        data: { url: message.url || '/laporan.html' },
+    }));
+});
+
+self.addEventListener('notificationclick', (event) => {
+    event.notification.close();
+    event.waitUntil(self.clients.openWindow(event.notification.data.url));
+});
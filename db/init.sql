@@ -14,5 +14,5 @@ CREATE INDEX IF NOT EXISTS idx_laporan_status ON laporan(status);
 -- Insert sample data for testing
 INSERT INTO laporan (title, description, status) VALUES
     ('Sample Report 1', 'This is a test report', 'pending'),
-    ('Sample Report 2', 'Another test report', 'in_progress'),
-    ('Sample Report 3', 'Completed test report', 'completed');
+    ('Sample Report 2', 'Another test report', 'diproses'),
+    ('Sample Report 3', 'Completed test report', 'selesai');
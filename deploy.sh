@@ -88,6 +88,42 @@ cd ..
 
 echo ""
 echo "Step 2: Deploying to Kubernetes..."
+# Anonim token keys: generated once per cluster and kept across redeploys (cleanup.sh
+# leaves them alone, so issued tokens stay valid). The private key only ever goes in a
+# Secret; the public key is published to service-pembuat-laporan in a ConfigMap.
+echo "Preparing anonim token keys..."
+if ! kubectl get secret anon-token-keys &> /dev/null; then
+    ANON_KEY_FILE=$(mktemp)
+    openssl genrsa -out "$ANON_KEY_FILE" 2048 2>/dev/null || exit 1
+    kubectl create secret generic anon-token-keys --from-file=ANON_TOKEN_PRIVATE_KEY="$ANON_KEY_FILE" || exit 1
+    rm -f "$ANON_KEY_FILE"
+    echo "Generated a new anonim token key pair"
+fi
+ANON_PUB_FILE=$(mktemp)
+kubectl get secret anon-token-keys -o jsonpath='{.data.ANON_TOKEN_PRIVATE_KEY}' | base64 -d | openssl rsa -pubout -out "$ANON_PUB_FILE" 2>/dev/null
+[ -s "$ANON_PUB_FILE" ] || { echo "Could not derive the anonim token public key"; exit 1; }
+kubectl create configmap anon-token-public-key --from-file=ANON_TOKEN_PUBLIC_KEY="$ANON_PUB_FILE" --dry-run=client -o yaml | kubectl apply -f - || exit 1
+rm -f "$ANON_PUB_FILE"
+echo ""
+
+# Web Push (VAPID) keys: a P-256 pair generated once per cluster and kept across
+# redeploys, so existing browser subscriptions keep working. Both halves go in one
+# Secret, in the raw base64url form service-pembuat-laporan expects.
+echo "Preparing Web Push keys..."
+if ! kubectl get secret vapid-keys &> /dev/null; then
+    VAPID_KEY_FILE=$(mktemp)
+    openssl ecparam -name prime256v1 -genkey -noout -out "$VAPID_KEY_FILE" || exit 1
+    VAPID_PRIVATE_KEY=$(openssl ec -in "$VAPID_KEY_FILE" -outform DER 2>/dev/null | tail -c +8 | head -c 32 | base64 | tr '+/' '-_' | tr -d '=\n')
+    VAPID_PUBLIC_KEY=$(openssl ec -in "$VAPID_KEY_FILE" -pubout -outform DER 2>/dev/null | tail -c 65 | base64 | tr '+/' '-_' | tr -d '=\n')
+    rm -f "$VAPID_KEY_FILE"
+    [ -n "$VAPID_PRIVATE_KEY" ] && [ -n "$VAPID_PUBLIC_KEY" ] || { echo "Could not generate the Web Push keys"; exit 1; }
+    kubectl create secret generic vapid-keys \
+        --from-literal=VAPID_PUBLIC_KEY="$VAPID_PUBLIC_KEY" \
+        --from-literal=VAPID_PRIVATE_KEY="$VAPID_PRIVATE_KEY" || exit 1
+    echo "Generated a new Web Push key pair"
+fi
+echo ""
+
 kubectl apply -f k8s-all-in-one.yaml
 
 echo ""
@@ -98,6 +134,7 @@ echo "Waiting for database deployments..."
 kubectl wait --for=condition=available --timeout=120s deployment/postgres-warga
 kubectl wait --for=condition=available --timeout=120s deployment/postgres-admin
 kubectl wait --for=condition=available --timeout=120s deployment/postgres-laporan
+kubectl wait --for=condition=available --timeout=120s deployment/minio
 
 # Wait for service deployments
 echo "Waiting for service deployments..."
@@ -214,6 +214,59 @@ test_data_in_transit() {
     else
         echo -e "  ${GRAY}ℹ️ INFO: Endpoint returned $RESPONSE for SQL injection test${NC}"
     fi
+    
+    # Test 2.6: Public listing must never expose reporter NIK
+    echo -e "\n${CYAN}[TEST 2.6] Public Listing Does Not Expose NIK${NC}"
+    PUBLIC_BODY=$(curl $CURL_OPTS -s "$BASE_URL/api/warga/laporan/public?page=1&limit=100" 2>/dev/null)
+    if [ -z "$PUBLIC_BODY" ]; then
+        echo -e "  ${YELLOW}⚠️ WARNING: Could not fetch public listing${NC}"
+        ((WARNINGS++))
+    elif echo "$PUBLIC_BODY" | grep -q '"user_nik"'; then
+        echo -e "  ${RED}❌ FAIL: Public listing contains a user_nik field${NC}"
+        ((FAILED++))
+    elif echo "$PUBLIC_BODY" | grep -Eq '(^|[^0-9])[0-9]{16}([^0-9]|$)'; then
+        echo -e "  ${RED}❌ FAIL: Public listing contains a NIK-shaped (16 digit) value${NC}"
+        ((FAILED++))
+    else
+        echo -e "  ${GREEN}✅ PASS: No NIK or NIK-shaped value in public listing${NC}"
+        ((PASSED++))
+    fi
+    
+    # Spoofed identity headers must not unlock ownership flags or NIKs
+    SPOOF_BODY=$(curl $CURL_OPTS -s -H "X-User-NIK: 1234567890123456" "$BASE_URL/api/warga/laporan/public?page=1&limit=100" 2>/dev/null)
+    if echo "$SPOOF_BODY" | grep -q '"is_mine":true' || echo "$SPOOF_BODY" | grep -Eq '(^|[^0-9])[0-9]{16}([^0-9]|$)'; then
+        echo -e "  ${RED}❌ FAIL: Spoofed X-User-NIK header changed the public response${NC}"
+        ((FAILED++))
+    else
+        echo -e "  ${GREEN}✅ PASS: Spoofed X-User-NIK header is ignored${NC}"
+        ((PASSED++))
+    fi
+
+    # Test 2.7: Cursor pagination rejects tampered cursors
+    echo -e "\n${CYAN}[TEST 2.7] Cursor Pagination${NC}"
+    CURSOR_BODY=$(curl $CURL_OPTS -s "$BASE_URL/api/warga/laporan/public?cursor=&limit=5" 2>/dev/null)
+    BAD_CURSOR_CODE=$(curl $CURL_OPTS -s -o /dev/null -w "%{http_code}" "$BASE_URL/api/warga/laporan/public?cursor=not-a-cursor" 2>/dev/null)
+    if ! echo "$CURSOR_BODY" | grep -q '"nextCursor"'; then
+        echo -e "  ${RED}❌ FAIL: Cursor mode response has no nextCursor field${NC}"
+        ((FAILED++))
+    elif [ "$BAD_CURSOR_CODE" != "400" ]; then
+        echo -e "  ${RED}❌ FAIL: Invalid cursor returned HTTP $BAD_CURSOR_CODE (expected 400)${NC}"
+        ((FAILED++))
+    else
+        echo -e "  ${GREEN}✅ PASS: Cursor mode works and invalid cursors are rejected${NC}"
+        ((PASSED++))
+    fi
+
+    # Test 2.8: Hidden or missing reports are indistinguishable (404, never 403)
+    echo -e "\n${CYAN}[TEST 2.8] Report Detail Does Not Leak Existence${NC}"
+    DETAIL_CODE=$(curl $CURL_OPTS -s -o /dev/null -w "%{http_code}" "$BASE_URL/api/warga/laporan/999999999" 2>/dev/null)
+    if [ "$DETAIL_CODE" = "404" ]; then
+        echo -e "  ${GREEN}✅ PASS: Unknown report returns 404${NC}"
+        ((PASSED++))
+    else
+        echo -e "  ${RED}❌ FAIL: Unknown report returned HTTP $DETAIL_CODE (expected 404)${NC}"
+        ((FAILED++))
+    fi
 }
 
 # =============================================================================
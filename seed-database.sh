@@ -111,33 +111,33 @@ kubectl exec -i $POSTGRES_LAPORAN -- psql -U postgres -d laporandb << 'EOSQL'
 INSERT INTO laporan (title, description, tipe, divisi, user_nik, status) VALUES
     -- Laporan Kebersihan
     ('Sampah Menumpuk di Jalan Merdeka', 'Terdapat tumpukan sampah yang sudah berhari-hari tidak diangkut di Jalan Merdeka No. 45. Bau sudah menyengat dan mengganggu warga sekitar.', 'publik', 'kebersihan', '3201010101010001', 'pending'),
-    ('Got Tersumbat di Perumahan Griya Asri', 'Got di depan rumah blok C-12 tersumbat dan menyebabkan genangan air saat hujan.', 'publik', 'kebersihan', '3201010101010002', 'in_progress'),
-    ('Tempat Sampah Rusak di Taman Kota', 'Tempat sampah di taman kota bagian timur sudah rusak dan perlu diganti.', 'publik', 'kebersihan', '3201010101010003', 'completed'),
+    ('Got Tersumbat di Perumahan Griya Asri', 'Got di depan rumah blok C-12 tersumbat dan menyebabkan genangan air saat hujan.', 'publik', 'kebersihan', '3201010101010002', 'diproses'),
+    ('Tempat Sampah Rusak di Taman Kota', 'Tempat sampah di taman kota bagian timur sudah rusak dan perlu diganti.', 'publik', 'kebersihan', '3201010101010003', 'selesai'),
     ('Sampah Liar di Lahan Kosong', 'Ada pembuangan sampah liar di lahan kosong belakang pasar. Mohon ditindaklanjuti.', 'anonim', 'kebersihan', 'a1b2c3d4e5f6g7h8i9j0k1l2m3n4o5p6q7r8s9t0u1v2w3x4y5z6a7b8', 'pending'),
     
     -- Laporan Kesehatan
-    ('Puskesmas Kekurangan Obat', 'Puskesmas Kelurahan Sukamaju kehabisan stok obat dasar seperti paracetamol dan amoxicillin.', 'publik', 'kesehatan', '3201010101010004', 'in_progress'),
+    ('Puskesmas Kekurangan Obat', 'Puskesmas Kelurahan Sukamaju kehabisan stok obat dasar seperti paracetamol dan amoxicillin.', 'publik', 'kesehatan', '3201010101010004', 'diproses'),
     ('Fogging Demam Berdarah', 'Mohon dilakukan fogging di RT 05/RW 03 karena sudah ada 3 kasus DBD dalam sebulan terakhir.', 'publik', 'kesehatan', '3201010101010005', 'pending'),
-    ('Air PDAM Keruh', 'Air PDAM di daerah Cilandak sudah seminggu keruh dan berbau. Mohon dicek kualitasnya.', 'publik', 'kesehatan', '3201010101010006', 'pending'),
-    ('Makanan Kadaluarsa di Warung', 'Ditemukan makanan kemasan kadaluarsa dijual di warung dekat sekolah SDN 01.', 'anonim', 'kesehatan', 'b2c3d4e5f6g7h8i9j0k1l2m3n4o5p6q7r8s9t0u1v2w3x4y5z6a7b8c9', 'in_progress'),
+    ('Air PDAM Keruh', 'Air PDAM di daerah Cilandak sudah seminggu keruh dan berbau. Mohon dicek kualitasnya.', 'publik', 'kesehatan', '3201010101010006', 'verified'),
+    ('Makanan Kadaluarsa di Warung', 'Ditemukan makanan kemasan kadaluarsa dijual di warung dekat sekolah SDN 01.', 'anonim', 'kesehatan', 'b2c3d4e5f6g7h8i9j0k1l2m3n4o5p6q7r8s9t0u1v2w3x4y5z6a7b8c9', 'diproses'),
     
     -- Laporan Fasilitas Umum
     ('Lampu Jalan Mati', 'Lampu penerangan jalan di Jl. Sudirman KM 5 sudah mati selama 2 minggu. Membahayakan pengguna jalan malam hari.', 'publik', 'fasilitas umum', '3201010101010007', 'pending'),
-    ('Jalan Berlubang Besar', 'Terdapat lubang besar di Jl. Gatot Subroto yang sudah memakan korban kecelakaan motor.', 'publik', 'fasilitas umum', '3201010101010008', 'in_progress'),
-    ('Taman Bermain Rusak', 'Ayunan dan perosotan di taman bermain kelurahan sudah rusak dan berbahaya untuk anak-anak.', 'publik', 'fasilitas umum', '3201010101010009', 'completed'),
+    ('Jalan Berlubang Besar', 'Terdapat lubang besar di Jl. Gatot Subroto yang sudah memakan korban kecelakaan motor.', 'publik', 'fasilitas umum', '3201010101010008', 'diproses'),
+    ('Taman Bermain Rusak', 'Ayunan dan perosotan di taman bermain kelurahan sudah rusak dan berbahaya untuk anak-anak.', 'publik', 'fasilitas umum', '3201010101010009', 'selesai'),
     ('Jembatan Penyeberangan Rapuh', 'Jembatan penyeberangan orang di depan mall sudah kropos dan berbunyi saat diinjak.', 'publik', 'fasilitas umum', '3201010101010010', 'pending'),
     ('Halte Bus Tanpa Atap', 'Halte bus di Jl. Diponegoro atapnya hilang sehingga penumpang kehujanan.', 'anonim', 'fasilitas umum', 'c3d4e5f6g7h8i9j0k1l2m3n4o5p6q7r8s9t0u1v2w3x4y5z6a7b8c9d0', 'pending'),
     
     -- Laporan Kriminalitas
-    ('Pencurian Motor Marak', 'Dalam sebulan terakhir sudah 5 motor hilang di area parkir pasar. Mohon patroli ditingkatkan.', 'publik', 'kriminalitas', '3201010101010001', 'in_progress'),
+    ('Pencurian Motor Marak', 'Dalam sebulan terakhir sudah 5 motor hilang di area parkir pasar. Mohon patroli ditingkatkan.', 'publik', 'kriminalitas', '3201010101010001', 'diproses'),
     ('Pencopetan di Angkot', 'Sering terjadi pencopetan di angkot jurusan Terminal-Stasiun. Mohon ada petugas di halte.', 'anonim', 'kriminalitas', 'd4e5f6g7h8i9j0k1l2m3n4o5p6q7r8s9t0u1v2w3x4y5z6a7b8c9d0e1', 'pending'),
     ('Perjudian di Gang Sempit', 'Ada kegiatan perjudian rutin setiap malam di gang sempit belakang warnet.', 'anonim', 'kriminalitas', 'e5f6g7h8i9j0k1l2m3n4o5p6q7r8s9t0u1v2w3x4y5z6a7b8c9d0e1f2', 'pending'),
-    ('Preman Minta Uang Keamanan', 'Sekelompok preman meminta uang keamanan paksa kepada pedagang kaki lima di area stasiun.', 'anonim', 'kriminalitas', 'f6g7h8i9j0k1l2m3n4o5p6q7r8s9t0u1v2w3x4y5z6a7b8c9d0e1f2g3', 'in_progress'),
+    ('Preman Minta Uang Keamanan', 'Sekelompok preman meminta uang keamanan paksa kepada pedagang kaki lima di area stasiun.', 'anonim', 'kriminalitas', 'f6g7h8i9j0k1l2m3n4o5p6q7r8s9t0u1v2w3x4y5z6a7b8c9d0e1f2g3', 'diproses'),
     ('Vandalisme di Fasilitas Umum', 'Fasilitas umum seperti halte dan taman sering dicoret-coret oleh oknum tidak bertanggung jawab.', 'publik', 'kriminalitas', '3201010101010002', 'pending'),
     
     -- Additional mixed reports
     ('Trotoar Rusak Parah', 'Trotoar di sepanjang Jl. Asia Afrika rusak parah, berbahaya untuk pejalan kaki dan difabel.', 'publik', 'fasilitas umum', '3201010101010003', 'pending'),
-    ('Banjir Rutin Saat Hujan', 'Setiap hujan lebat, area perumahan kami selalu banjir setinggi lutut. Mohon perbaikan drainase.', 'publik', 'fasilitas umum', '3201010101010004', 'in_progress')
+    ('Banjir Rutin Saat Hujan', 'Setiap hujan lebat, area perumahan kami selalu banjir setinggi lutut. Mohon perbaikan drainase.', 'publik', 'fasilitas umum', '3201010101010004', 'diproses')
 ON CONFLICT DO NOTHING;
 
 -- Show summary
@@ -174,7 +174,7 @@ echo ""
 echo -e "  ${WHITE}Laporan:${NC}"
 echo "    - 20 sample laporan"
 echo "    - Mix of publik and anonim types"
-echo "    - Various statuses: pending, in_progress, completed"
+echo "    - Various statuses: pending, verified, diproses, selesai"
 echo ""
 echo -e "${YELLOW}💡 Quick Login:${NC}"
 echo "    Warga:  NIK=3201010101010001, Password=Password123!"
@@ -0,0 +1,249 @@
+package main
+
+import (
+	"crypto/rsa"
+	"crypto/x509"
+	"database/sql"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"log"
+	"math/big"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// Anonim tokens let a warga submit an anonim report without sending anything that
+// identifies them. The browser picks a random nonce, blinds its full-domain hash and
+// has it signed here with the warga's access token. After unblinding, the signature
+// is valid for the nonce, but this service has never seen either, so a spent token
+// cannot be linked back to the account it was issued to. service-pembuat-laporan
+// verifies tokens with the public key and keeps the store of spent ones.
+
+// Set from ANON_TOKEN_PRIVATE_KEY, ANON_TOKEN_LIMIT and ANON_TOKEN_WINDOW.
+// anonTokenKey is nil when no key is configured, which disables issuing.
+var anonTokenKey *rsa.PrivateKey
+var anonTokenLimit int
+var anonTokenWindow time.Duration
+
+func initAnonTokens() error {
+	var err error
+	anonTokenLimit, err = strconv.Atoi(getEnv("ANON_TOKEN_LIMIT", "5"))
+	if err != nil || anonTokenLimit < 1 {
+		return fmt.Errorf("invalid ANON_TOKEN_LIMIT")
+	}
+	anonTokenWindow, err = parseDuration(getEnv("ANON_TOKEN_WINDOW", "7d"))
+	if err != nil || anonTokenWindow <= 0 {
+		return fmt.Errorf("invalid ANON_TOKEN_WINDOW")
+	}
+
+	keyPEM := strings.TrimSpace(os.Getenv("ANON_TOKEN_PRIVATE_KEY"))
+	if keyPEM == "" {
+		log.Println("[ANON TOKEN] ANON_TOKEN_PRIVATE_KEY not set, anonim tokens disabled")
+		return nil
+	}
+	block, _ := pem.Decode([]byte(keyPEM))
+	if block == nil {
+		return fmt.Errorf("invalid ANON_TOKEN_PRIVATE_KEY: not PEM")
+	}
+	var key interface{}
+	if key, err = x509.ParsePKCS1PrivateKey(block.Bytes); err != nil {
+		if key, err = x509.ParsePKCS8PrivateKey(block.Bytes); err != nil {
+			return fmt.Errorf("invalid ANON_TOKEN_PRIVATE_KEY: %v", err)
+		}
+	}
+	rsaKey, ok := key.(*rsa.PrivateKey)
+	if !ok || rsaKey.N.BitLen() < 2048 {
+		return fmt.Errorf("invalid ANON_TOKEN_PRIVATE_KEY: need an RSA key of at least 2048 bits")
+	}
+	// The full-domain hash (anonTokenFDH in service-pembuat-laporan and the browser)
+	// clears only the top bit of a key-sized value, which is below n only when the
+	// modulus fills whole bytes
+	if rsaKey.N.BitLen()%8 != 0 {
+		return fmt.Errorf("invalid ANON_TOKEN_PRIVATE_KEY: modulus length must be a multiple of 8 bits")
+	}
+	rsaKey.Precompute()
+	anonTokenKey = rsaKey
+	return nil
+}
+
+// AnonTokenKeyResponse is the public key for GET /auth/anon-tokens/key, as base64url
+// big-endian integers
+type AnonTokenKeyResponse struct {
+	N string `json:"n"`
+	E string `json:"e"`
+}
+
+// GET /auth/anon-tokens/key - Public key the browser blinds against
+func anonTokenKeyHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeMethodNotAllowed(w)
+		return
+	}
+	if anonTokenKey == nil {
+		writeError(w, http.StatusServiceUnavailable, ErrCodeAnonTokensDisabled, "Anonim tokens are not configured")
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "public, max-age=3600")
+	json.NewEncoder(w).Encode(AnonTokenKeyResponse{
+		N: base64.RawURLEncoding.EncodeToString(anonTokenKey.N.Bytes()),
+		E: base64.RawURLEncoding.EncodeToString(big.NewInt(int64(anonTokenKey.E)).Bytes()),
+	})
+}
+
+// AnonTokenRequest is the POST /auth/anon-tokens body: blinded messages, base64url
+type AnonTokenRequest struct {
+	Blinded []string `json:"blinded"`
+}
+
+// AnonTokenResponse carries one blind signature per blinded message, in order
+type AnonTokenResponse struct {
+	Signatures []string `json:"signatures"`
+	Remaining  int      `json:"remaining"`
+}
+
+// POST /auth/anon-tokens - Sign blinded messages for the warga in the access token.
+// Each account may get ANON_TOKEN_LIMIT signatures per ANON_TOKEN_WINDOW. Only the
+// count is recorded, never what was signed.
+func issueAnonTokensHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeMethodNotAllowed(w)
+		return
+	}
+	if anonTokenKey == nil {
+		writeError(w, http.StatusServiceUnavailable, ErrCodeAnonTokensDisabled, "Anonim tokens are not configured")
+		return
+	}
+
+	authHeader := r.Header.Get("Authorization")
+	if !strings.HasPrefix(authHeader, "Bearer ") {
+		writeError(w, http.StatusUnauthorized, ErrCodeTokenMissing, "No token provided")
+		return
+	}
+	claims := &Claims{}
+	token, err := jwt.ParseWithClaims(strings.TrimPrefix(authHeader, "Bearer "), claims, func(token *jwt.Token) (interface{}, error) {
+		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
+			return nil, fmt.Errorf("unexpected signing method")
+		}
+		return jwtSecret, nil
+	})
+	if err != nil || !token.Valid || claims.Role != "warga" {
+		writeError(w, http.StatusUnauthorized, ErrCodeTokenInvalid, "Invalid token")
+		return
+	}
+
+	var req AnonTokenRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, ErrCodeInvalidRequestBody, "Invalid request body")
+		return
+	}
+	if len(req.Blinded) == 0 || len(req.Blinded) > anonTokenLimit {
+		writeFieldError(w, http.StatusBadRequest, ErrCodeValidationFailed, "Invalid number of blinded messages",
+			map[string]string{"blinded": fmt.Sprintf("must contain 1 to %d messages", anonTokenLimit)})
+		return
+	}
+	blinded := make([]*big.Int, len(req.Blinded))
+	for i, b := range req.Blinded {
+		raw, err := base64.RawURLEncoding.DecodeString(b)
+		m := new(big.Int).SetBytes(raw)
+		if err != nil || len(raw) != anonTokenKey.Size() || m.Sign() == 0 || m.Cmp(anonTokenKey.N) >= 0 {
+			writeFieldError(w, http.StatusBadRequest, ErrCodeValidationFailed, "Invalid blinded message",
+				map[string]string{"blinded": fmt.Sprintf("item %d is not a blinded message for this key", i)})
+			return
+		}
+		blinded[i] = m
+	}
+
+	// The user row lock serializes concurrent requests of one account
+	tx, err := db.Begin()
+	if err != nil {
+		log.Println("[ANON TOKEN ERROR] Begin transaction:", err)
+		writeError(w, http.StatusInternalServerError, ErrCodeInternal, "Failed to issue anonim tokens")
+		return
+	}
+	defer tx.Rollback()
+
+	var issued int
+	var oldest sql.NullTime
+	err = tx.QueryRow(`SELECT id FROM users WHERE id = $1 FOR UPDATE`, claims.UserID).Scan(&claims.UserID)
+	if errors.Is(err, sql.ErrNoRows) {
+		writeError(w, http.StatusUnauthorized, ErrCodeUserNotFound, "User not found")
+		return
+	}
+	if err == nil {
+		err = tx.QueryRow(`
+			SELECT COALESCE(SUM(token_count), 0), MIN(issued_at) FROM anon_token_issuance
+			WHERE user_id = $1 AND issued_at > $2
+		`, claims.UserID, time.Now().Add(-anonTokenWindow)).Scan(&issued, &oldest)
+	}
+	if err != nil {
+		log.Println("[ANON TOKEN ERROR] Database error:", err)
+		writeError(w, http.StatusInternalServerError, ErrCodeInternal, "Failed to issue anonim tokens")
+		return
+	}
+	if issued+len(blinded) > anonTokenLimit {
+		log.Printf("[ANON TOKEN] Limit reached for user id %d\n", claims.UserID)
+		retryAfter := anonTokenWindow
+		if oldest.Valid {
+			retryAfter = time.Until(oldest.Time.Add(anonTokenWindow))
+		}
+		w.Header().Set("Retry-After", strconv.Itoa(int(retryAfter.Seconds())+1))
+		writeError(w, http.StatusTooManyRequests, ErrCodeAnonTokenLimitReached,
+			fmt.Sprintf("At most %d anonim tokens per %s, %d left", anonTokenLimit, getEnv("ANON_TOKEN_WINDOW", "7d"), anonTokenLimit-issued))
+		return
+	}
+
+	resp := AnonTokenResponse{Signatures: make([]string, len(blinded)), Remaining: anonTokenLimit - issued - len(blinded)}
+	for i, m := range blinded {
+		sig, err := blindSign(anonTokenKey, m)
+		if err != nil {
+			log.Println("[ANON TOKEN ERROR] Signing failed:", err)
+			writeError(w, http.StatusInternalServerError, ErrCodeInternal, "Failed to issue anonim tokens")
+			return
+		}
+		resp.Signatures[i] = base64.RawURLEncoding.EncodeToString(sig)
+	}
+
+	_, err = tx.Exec(`INSERT INTO anon_token_issuance (user_id, token_count) VALUES ($1, $2)`, claims.UserID, len(blinded))
+	if err == nil {
+		err = tx.Commit()
+	}
+	if err != nil {
+		log.Println("[ANON TOKEN ERROR] Database error:", err)
+		writeError(w, http.StatusInternalServerError, ErrCodeInternal, "Failed to issue anonim tokens")
+		return
+	}
+
+	log.Printf("[ANON TOKEN SUCCESS] Issued %d anonim tokens to user id %d\n", len(blinded), claims.UserID)
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	json.NewEncoder(w).Encode(resp)
+}
+
+// blindSign computes m^d mod n and checks the result before releasing it, so a fault
+// during the CRT computation cannot leak the key. The output is padded to the key size.
+func blindSign(key *rsa.PrivateKey, m *big.Int) ([]byte, error) {
+	var s *big.Int
+	if pc := key.Precomputed; pc.Dp != nil && len(key.Primes) == 2 {
+		p, q := key.Primes[0], key.Primes[1]
+		m1 := new(big.Int).Exp(m, pc.Dp, p)
+		m2 := new(big.Int).Exp(m, pc.Dq, q)
+		h := new(big.Int).Sub(m1, m2)
+		h.Mul(h, pc.Qinv).Mod(h, p)
+		s = h.Mul(h, q).Add(h, m2)
+	} else {
+		s = new(big.Int).Exp(m, key.D, key.N)
+	}
+	if new(big.Int).Exp(s, big.NewInt(int64(key.E)), key.N).Cmp(m) != 0 {
+		return nil, errors.New("signature check failed")
+	}
+	return s.FillBytes(make([]byte, key.Size())), nil
+}
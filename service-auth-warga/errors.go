@@ -0,0 +1,59 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+)
+
+// Error codes returned in the "code" field of every error response.
+// The full catalog with HTTP statuses lives in ERROR-CODES.md at the repo root;
+// keep both in sync when adding a code.
+const (
+	ErrCodeMethodNotAllowed      = "METHOD_NOT_ALLOWED"
+	ErrCodeInvalidRequestBody    = "INVALID_REQUEST_BODY"
+	ErrCodeValidationFailed      = "VALIDATION_FAILED"
+	ErrCodeNIKInvalid            = "NIK_INVALID"
+	ErrCodeNIKOrEmailTaken       = "NIK_OR_EMAIL_TAKEN"
+	ErrCodeInvalidCredentials    = "INVALID_CREDENTIALS"
+	ErrCodeTokenMissing          = "TOKEN_MISSING"
+	ErrCodeTokenInvalid          = "TOKEN_INVALID"
+	ErrCodeRefreshTokenInvalid   = "REFRESH_TOKEN_INVALID"
+	ErrCodeUserNotFound          = "USER_NOT_FOUND"
+	ErrCodePasswordInvalid       = "PASSWORD_INVALID"
+	ErrCodeAnonTokensDisabled    = "ANON_TOKENS_DISABLED"
+	ErrCodeAnonTokenLimitReached = "ANON_TOKEN_LIMIT_REACHED"
+	ErrCodeInternal              = "INTERNAL_ERROR"
+)
+
+// APIError is the machine-readable error object sent to clients.
+// Fields maps request field names to a human-readable reason and is omitted when empty.
+type APIError struct {
+	Code    string            `json:"code"`
+	Message string            `json:"message"`
+	Fields  map[string]string `json:"fields,omitempty"`
+}
+
+// ErrorResponse wraps APIError so every error body has the shape {"error":{...}}
+type ErrorResponse struct {
+	Error APIError `json:"error"`
+}
+
+// writeError sends a JSON error envelope with the given HTTP status
+func writeError(w http.ResponseWriter, status int, code, message string) {
+	writeFieldError(w, status, code, message, nil)
+}
+
+// writeFieldError sends a JSON error envelope including per-field validation reasons
+func writeFieldError(w http.ResponseWriter, status int, code, message string, fields map[string]string) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(ErrorResponse{
+		Error: APIError{Code: code, Message: message, Fields: fields},
+	})
+}
+
+// writeMethodNotAllowed is shared by every handler that only accepts one method
+func writeMethodNotAllowed(w http.ResponseWriter) {
+	writeError(w, http.StatusMethodNotAllowed, ErrCodeMethodNotAllowed, "Method not allowed")
+}
@@ -93,6 +93,10 @@ func main() {
 	}
 	log.Println("Successfully connected to warga database")
 
+	if err := initAnonTokens(); err != nil {
+		log.Fatal("Failed to configure anonim tokens:", err)
+	}
+
 	// Setup routes
 	http.HandleFunc("/auth/register", corsMiddleware(registerHandler))
 	http.HandleFunc("/auth/login", corsMiddleware(loginHandler))
@@ -100,6 +104,8 @@ func main() {
 	http.HandleFunc("/auth/verify-password", corsMiddleware(verifyPasswordHandler))
 	http.HandleFunc("/auth/refresh", corsMiddleware(refreshTokenHandler))
 	http.HandleFunc("/auth/logout", corsMiddleware(logoutHandler))
+	http.HandleFunc("/auth/anon-tokens", corsMiddleware(issueAnonTokensHandler))
+	http.HandleFunc("/auth/anon-tokens/key", corsMiddleware(anonTokenKeyHandler))
 	http.HandleFunc("/health", healthHandler)
 
 	port := getEnv("PORT", "8081")
@@ -128,25 +134,31 @@ func corsMiddleware(next http.HandlerFunc) http.HandlerFunc {
 
 func registerHandler(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		writeMethodNotAllowed(w)
 		return
 	}
 
 	var req RegisterRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		http.Error(w, `{"error":"Invalid request body"}`, http.StatusBadRequest)
+		writeError(w, http.StatusBadRequest, ErrCodeInvalidRequestBody, "Invalid request body")
 		return
 	}
 
 	log.Printf("[REGISTER] Attempt to register warga: %s\n", req.NIK)
 
 	if req.NIK == "" || req.Nama == "" || req.Email == "" || req.Password == "" {
-		http.Error(w, `{"error":"NIK, nama, email, and password are required"}`, http.StatusBadRequest)
+		fields := map[string]string{}
+		for name, value := range map[string]string{"nik": req.NIK, "nama": req.Nama, "email": req.Email, "password": req.Password} {
+			if value == "" {
+				fields[name] = "required"
+			}
+		}
+		writeFieldError(w, http.StatusBadRequest, ErrCodeValidationFailed, "NIK, nama, email, and password are required", fields)
 		return
 	}
 
-	if len(req.NIK) != 16 {
-		http.Error(w, `{"error":"NIK must be exactly 16 digits"}`, http.StatusBadRequest)
+	if !isValidNIK(req.NIK) {
+		writeFieldError(w, http.StatusBadRequest, ErrCodeNIKInvalid, "NIK must be exactly 16 digits", map[string]string{"nik": "must be exactly 16 digits"})
 		return
 	}
 
@@ -154,13 +166,13 @@ func registerHandler(w http.ResponseWriter, r *http.Request) {
 	var existingID int
 	err := db.QueryRow("SELECT id FROM users WHERE nik = $1 OR email = $2", req.NIK, req.Email).Scan(&existingID)
 	if err == nil {
-		http.Error(w, `{"error":"NIK or email already exists"}`, http.StatusConflict)
+		writeError(w, http.StatusConflict, ErrCodeNIKOrEmailTaken, "NIK or email already exists")
 		return
 	}
 
 	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(req.Password), bcrypt.DefaultCost)
 	if err != nil {
-		http.Error(w, `{"error":"Failed to hash password"}`, http.StatusInternalServerError)
+		writeError(w, http.StatusInternalServerError, ErrCodeInternal, "Failed to hash password")
 		return
 	}
 
@@ -171,7 +183,7 @@ func registerHandler(w http.ResponseWriter, r *http.Request) {
 	).Scan(&user.ID, &user.NIK, &user.Nama, &user.Email, &user.CreatedAt)
 
 	if err != nil {
-		http.Error(w, `{"error":"Failed to register user"}`, http.StatusInternalServerError)
+		writeError(w, http.StatusInternalServerError, ErrCodeInternal, "Failed to register user")
 		return
 	}
 
@@ -194,20 +206,27 @@ func registerHandler(w http.ResponseWriter, r *http.Request) {
 
 func loginHandler(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		writeMethodNotAllowed(w)
 		return
 	}
 
 	var req LoginRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		http.Error(w, `{"error":"Invalid request body"}`, http.StatusBadRequest)
+		writeError(w, http.StatusBadRequest, ErrCodeInvalidRequestBody, "Invalid request body")
 		return
 	}
 
 	log.Printf("[LOGIN] Warga login attempt: %s\n", req.NIK)
 
 	if req.NIK == "" || req.Password == "" {
-		http.Error(w, `{"error":"NIK and password are required"}`, http.StatusBadRequest)
+		fields := map[string]string{}
+		if req.NIK == "" {
+			fields["nik"] = "required"
+		}
+		if req.Password == "" {
+			fields["password"] = "required"
+		}
+		writeFieldError(w, http.StatusBadRequest, ErrCodeValidationFailed, "NIK and password are required", fields)
 		return
 	}
 
@@ -218,12 +237,12 @@ func loginHandler(w http.ResponseWriter, r *http.Request) {
 	).Scan(&user.ID, &user.NIK, &user.Nama, &user.Email, &user.PasswordHash)
 
 	if err != nil {
-		http.Error(w, `{"error":"Invalid credentials"}`, http.StatusUnauthorized)
+		writeError(w, http.StatusUnauthorized, ErrCodeInvalidCredentials, "Invalid credentials")
 		return
 	}
 
 	if err := bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(req.Password)); err != nil {
-		http.Error(w, `{"error":"Invalid credentials"}`, http.StatusUnauthorized)
+		writeError(w, http.StatusUnauthorized, ErrCodeInvalidCredentials, "Invalid credentials")
 		return
 	}
 
@@ -243,7 +262,7 @@ func loginHandler(w http.ResponseWriter, r *http.Request) {
 
 	accessTokenString, err := accessToken.SignedString(jwtSecret)
 	if err != nil {
-		http.Error(w, `{"error":"Failed to generate token"}`, http.StatusInternalServerError)
+		writeError(w, http.StatusInternalServerError, ErrCodeInternal, "Failed to generate token")
 		return
 	}
 
@@ -257,7 +276,7 @@ func loginHandler(w http.ResponseWriter, r *http.Request) {
 
 	refreshTokenString, err := refreshToken.SignedString(jwtRefreshSecret)
 	if err != nil {
-		http.Error(w, `{"error":"Failed to generate refresh token"}`, http.StatusInternalServerError)
+		writeError(w, http.StatusInternalServerError, ErrCodeInternal, "Failed to generate refresh token")
 		return
 	}
 
@@ -268,7 +287,7 @@ func loginHandler(w http.ResponseWriter, r *http.Request) {
 	)
 
 	if err != nil {
-		http.Error(w, `{"error":"Failed to store refresh token"}`, http.StatusInternalServerError)
+		writeError(w, http.StatusInternalServerError, ErrCodeInternal, "Failed to store refresh token")
 		return
 	}
 
@@ -291,13 +310,13 @@ func loginHandler(w http.ResponseWriter, r *http.Request) {
 
 func verifyTokenHandler(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodGet {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		writeMethodNotAllowed(w)
 		return
 	}
 
 	authHeader := r.Header.Get("Authorization")
 	if authHeader == "" || !strings.HasPrefix(authHeader, "Bearer ") {
-		http.Error(w, `{"error":"No token provided"}`, http.StatusUnauthorized)
+		writeError(w, http.StatusUnauthorized, ErrCodeTokenMissing, "No token provided")
 		return
 	}
 
@@ -308,7 +327,7 @@ func verifyTokenHandler(w http.ResponseWriter, r *http.Request) {
 	})
 
 	if err != nil || !token.Valid {
-		http.Error(w, `{"error":"Invalid token"}`, http.StatusUnauthorized)
+		writeError(w, http.StatusUnauthorized, ErrCodeTokenInvalid, "Invalid token")
 		return
 	}
 
@@ -319,7 +338,7 @@ func verifyTokenHandler(w http.ResponseWriter, r *http.Request) {
 	).Scan(&user.ID, &user.NIK, &user.Nama, &user.Email)
 
 	if err != nil {
-		http.Error(w, `{"error":"User not found"}`, http.StatusUnauthorized)
+		writeError(w, http.StatusUnauthorized, ErrCodeUserNotFound, "User not found")
 		return
 	}
 
@@ -338,18 +357,18 @@ func verifyTokenHandler(w http.ResponseWriter, r *http.Request) {
 
 func refreshTokenHandler(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		writeMethodNotAllowed(w)
 		return
 	}
 
 	var req RefreshTokenRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		http.Error(w, `{"error":"Invalid request body"}`, http.StatusBadRequest)
+		writeError(w, http.StatusBadRequest, ErrCodeInvalidRequestBody, "Invalid request body")
 		return
 	}
 
 	if req.RefreshToken == "" {
-		http.Error(w, `{"error":"Refresh token is required"}`, http.StatusBadRequest)
+		writeFieldError(w, http.StatusBadRequest, ErrCodeValidationFailed, "Refresh token is required", map[string]string{"refreshToken": "required"})
 		return
 	}
 
@@ -359,7 +378,7 @@ func refreshTokenHandler(w http.ResponseWriter, r *http.Request) {
 	})
 
 	if err != nil || !token.Valid {
-		http.Error(w, `{"error":"Invalid refresh token"}`, http.StatusUnauthorized)
+		writeError(w, http.StatusUnauthorized, ErrCodeRefreshTokenInvalid, "Invalid refresh token")
 		return
 	}
 
@@ -372,7 +391,7 @@ func refreshTokenHandler(w http.ResponseWriter, r *http.Request) {
 	).Scan(&tokenID, &revoked, &expiresAt)
 
 	if err != nil || revoked || expiresAt.Before(time.Now()) {
-		http.Error(w, `{"error":"Invalid or expired refresh token"}`, http.StatusUnauthorized)
+		writeError(w, http.StatusUnauthorized, ErrCodeRefreshTokenInvalid, "Invalid or expired refresh token")
 		return
 	}
 
@@ -383,7 +402,7 @@ func refreshTokenHandler(w http.ResponseWriter, r *http.Request) {
 	).Scan(&user.ID, &user.NIK, &user.Nama, &user.Email)
 
 	if err != nil {
-		http.Error(w, `{"error":"User not found"}`, http.StatusUnauthorized)
+		writeError(w, http.StatusUnauthorized, ErrCodeUserNotFound, "User not found")
 		return
 	}
 
@@ -401,7 +420,7 @@ func refreshTokenHandler(w http.ResponseWriter, r *http.Request) {
 
 	accessTokenString, err := accessToken.SignedString(jwtSecret)
 	if err != nil {
-		http.Error(w, `{"error":"Failed to generate token"}`, http.StatusInternalServerError)
+		writeError(w, http.StatusInternalServerError, ErrCodeInternal, "Failed to generate token")
 		return
 	}
 
@@ -420,24 +439,24 @@ func refreshTokenHandler(w http.ResponseWriter, r *http.Request) {
 
 func logoutHandler(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		writeMethodNotAllowed(w)
 		return
 	}
 
 	var req RefreshTokenRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		http.Error(w, `{"error":"Invalid request body"}`, http.StatusBadRequest)
+		writeError(w, http.StatusBadRequest, ErrCodeInvalidRequestBody, "Invalid request body")
 		return
 	}
 
 	if req.RefreshToken == "" {
-		http.Error(w, `{"error":"Refresh token is required"}`, http.StatusBadRequest)
+		writeFieldError(w, http.StatusBadRequest, ErrCodeValidationFailed, "Refresh token is required", map[string]string{"refreshToken": "required"})
 		return
 	}
 
 	_, err := db.Exec("UPDATE refresh_tokens SET revoked = TRUE WHERE token = $1", req.RefreshToken)
 	if err != nil {
-		http.Error(w, `{"error":"Failed to logout"}`, http.StatusInternalServerError)
+		writeError(w, http.StatusInternalServerError, ErrCodeInternal, "Failed to logout")
 		return
 	}
 
@@ -450,6 +469,19 @@ func healthHandler(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(map[string]string{"status": "healthy"})
 }
 
+// isValidNIK checks the NIK is exactly 16 ASCII digits
+func isValidNIK(nik string) bool {
+	if len(nik) != 16 {
+		return false
+	}
+	for _, c := range nik {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+	return true
+}
+
 func getEnv(key, defaultValue string) string {
 	value := os.Getenv(key)
 	if value == "" {
@@ -462,14 +494,14 @@ func getEnv(key, defaultValue string) string {
 // Used for anonim report submission to validate user password
 func verifyPasswordHandler(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		writeMethodNotAllowed(w)
 		return
 	}
 
 	// Get token from Authorization header
 	authHeader := r.Header.Get("Authorization")
 	if authHeader == "" || len(authHeader) < 8 {
-		http.Error(w, `{"error":"No token provided"}`, http.StatusUnauthorized)
+		writeError(w, http.StatusUnauthorized, ErrCodeTokenMissing, "No token provided")
 		return
 	}
 
@@ -481,13 +513,13 @@ func verifyPasswordHandler(w http.ResponseWriter, r *http.Request) {
 	})
 
 	if err != nil || !token.Valid {
-		http.Error(w, `{"error":"Invalid token"}`, http.StatusUnauthorized)
+		writeError(w, http.StatusUnauthorized, ErrCodeTokenInvalid, "Invalid token")
 		return
 	}
 
 	claims, ok := token.Claims.(*Claims)
 	if !ok {
-		http.Error(w, `{"error":"Invalid token claims"}`, http.StatusUnauthorized)
+		writeError(w, http.StatusUnauthorized, ErrCodeTokenInvalid, "Invalid token claims")
 		return
 	}
 
@@ -496,12 +528,12 @@ func verifyPasswordHandler(w http.ResponseWriter, r *http.Request) {
 		Password string `json:"password"`
 	}
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		http.Error(w, `{"error":"Invalid request body"}`, http.StatusBadRequest)
+		writeError(w, http.StatusBadRequest, ErrCodeInvalidRequestBody, "Invalid request body")
 		return
 	}
 
 	if req.Password == "" {
-		http.Error(w, `{"error":"Password is required"}`, http.StatusBadRequest)
+		writeFieldError(w, http.StatusBadRequest, ErrCodeValidationFailed, "Password is required", map[string]string{"password": "required"})
 		return
 	}
 
@@ -516,14 +548,14 @@ func verifyPasswordHandler(w http.ResponseWriter, r *http.Request) {
 
 	if err != nil {
 		log.Printf("[VERIFY PASSWORD ERROR] User not found: %s\n", claims.NIK)
-		http.Error(w, `{"error":"User not found"}`, http.StatusUnauthorized)
+		writeError(w, http.StatusUnauthorized, ErrCodeUserNotFound, "User not found")
 		return
 	}
 
 	// Compare password
 	if err := bcrypt.CompareHashAndPassword([]byte(passwordHash), []byte(req.Password)); err != nil {
 		log.Printf("[VERIFY PASSWORD ERROR] Invalid password for user: %s\n", claims.NIK)
-		http.Error(w, `{"error":"Invalid password"}`, http.StatusUnauthorized)
+		writeError(w, http.StatusUnauthorized, ErrCodePasswordInvalid, "Invalid password")
 		return
 	}
 
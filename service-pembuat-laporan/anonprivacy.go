@@ -0,0 +1,144 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"math/big"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Anonim reports are also protected against timing and metadata correlation, e.g. an
+// exact created_at matched against login events in service-auth-warga:
+//   - their timestamps are stored rounded down to anonTimeGranularity by the
+//     coarsen_anonim_* triggers in laporan-db-init, and comment times are rounded on output
+//   - their ids are random instead of the next SERIAL value, so the id does not place
+//     them between publik reports with exact timestamps
+//   - officers only see them after a random delay of up to ANON_PUBLISH_DELAY_MAX
+//   - they are sent to /anonim/..., which the ingress does not access-log and which
+//     drops client addresses, user agent and the X-Served-By pod name
+
+// Same granularity as anon_coarse_time() in laporan-db-init
+const anonTimeGranularity = time.Hour
+
+// Path prefix for anonim requests (laporan-anonim-ingress maps /api/warga/anonim/laporan here)
+const anonimPathPrefix = "/anonim"
+
+// Random ids for anonim reports, well above anything the SERIAL sequence reaches
+const (
+	anonimIDMin = 1_000_000_000
+	anonimIDMax = 1<<31 - 1
+)
+
+// Set from ANON_PUBLISH_DELAY_MAX; zero publishes anonim reports immediately
+var anonPublishDelayMax time.Duration
+
+func initAnonPrivacy() error {
+	var err error
+	anonPublishDelayMax, err = parseDuration(getEnv("ANON_PUBLISH_DELAY_MAX", "0s"))
+	if err != nil || anonPublishDelayMax < 0 {
+		return fmt.Errorf("invalid ANON_PUBLISH_DELAY_MAX")
+	}
+	return nil
+}
+
+// coarseAnonTime rounds a timestamp of an anonim report down for output
+func coarseAnonTime(t time.Time) time.Time {
+	return t.Truncate(anonTimeGranularity)
+}
+
+type anonimPathKey struct{}
+
+// anonimRouteAllowed limits the anonim path to creating anonim reports and to what a
+// tracking code gives access to. Everything else needs an account and goes through the
+// normal path, where the client address is kept for the rate limits.
+func anonimRouteAllowed(path string) bool {
+	if path == "/laporan" || path == "/laporan/track" || path == "/laporan/track/migrate" {
+		return true
+	}
+	if !strings.HasPrefix(path, "/laporan/") {
+		return false
+	}
+	parts := strings.Split(strings.Trim(strings.TrimPrefix(path, "/laporan/"), "/"), "/")
+	if parts[0] == "attachments" {
+		return len(parts) == 2
+	}
+	if _, ok := parseLaporanID(parts[0]); !ok {
+		return false
+	}
+	return len(parts) == 1 || parts[1] == "attachments" || parts[1] == "comments"
+}
+
+// anonimPath serves a request under /anonim/ as the same route without the prefix,
+// after dropping everything that identifies the client or the pod that handled it.
+// Handlers check isAnonimPath to keep per-request details out of the logs.
+func anonimPath(next http.Handler) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !anonimRouteAllowed(strings.TrimPrefix(r.URL.Path, anonimPathPrefix)) {
+			writeError(w, http.StatusNotFound, ErrCodeNotFound, "Not found")
+			return
+		}
+		for _, h := range []string{"X-Forwarded-For", "X-Real-IP", "X-Original-Forwarded-For", "Forwarded", "User-Agent", "Referer"} {
+			r.Header.Del(h)
+		}
+		r.RemoteAddr = ""
+		r = r.WithContext(context.WithValue(r.Context(), anonimPathKey{}, true))
+		http.StripPrefix(anonimPathPrefix, next).ServeHTTP(w, r)
+	}
+}
+
+func isAnonimPath(r *http.Request) bool {
+	on, _ := r.Context().Value(anonimPathKey{}).(bool)
+	return on
+}
+
+// logRequestf logs a per-request line unless the request came in on the anonim path,
+// where ids and times in the log could be matched against other logs
+func logRequestf(r *http.Request, format string, v ...interface{}) {
+	if isAnonimPath(r) {
+		return
+	}
+	log.Printf(format, v...)
+}
+
+func randomBelow(n int64) (int64, error) {
+	v, err := rand.Int(rand.Reader, big.NewInt(n))
+	if err != nil {
+		return 0, err
+	}
+	return v.Int64(), nil
+}
+
+// insertAnonimLaporan inserts an anonim report under a random id, drawing again on
+// the rare collision, and holds it back from officers for a random publication delay
+func insertAnonimLaporan(tx *sql.Tx, req CreateLaporanRequest, trackingCodeHash string, lat, lng, accuracy *float64) (int, error) {
+	var delay int64
+	if anonPublishDelayMax > 0 {
+		var err error
+		if delay, err = randomBelow(int64(anonPublishDelayMax/time.Second) + 1); err != nil {
+			return 0, err
+		}
+	}
+	for {
+		candidate, err := randomBelow(anonimIDMax - anonimIDMin)
+		if err != nil {
+			return 0, err
+		}
+		var id int
+		err = tx.QueryRow(`
+			INSERT INTO laporan (id, title, description, tipe, divisi, tracking_code_hash, status, latitude, longitude, location_accuracy_m, published_at)
+			VALUES ($1, $2, $3, 'anonim', $4, $5, $6, $7, $8, $9, CURRENT_TIMESTAMP + $10::double precision * INTERVAL '1 second')
+			ON CONFLICT (id) DO NOTHING
+			RETURNING id
+		`, anonimIDMin+candidate, req.Title, req.Description, req.Divisi, trackingCodeHash, statusPending, lat, lng, accuracy, delay).Scan(&id)
+		if errors.Is(err, sql.ErrNoRows) {
+			continue
+		}
+		return id, err
+	}
+}
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/sha512"
+	"crypto/x509"
+	"database/sql"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/pem"
+	"fmt"
+	"log"
+	"math/big"
+	"net/http"
+	"os"
+	"strings"
+)
+
+// Header carrying an anonim token issued blind by service-auth-warga, as
+// base64url(nonce) "." base64url(signature). Anonim reports are sent with this header
+// instead of an access token, so nothing in the request identifies the reporter.
+const anonTokenHeader = "X-Anonim-Token"
+
+const (
+	anonTokenNonceBytes = 32
+	// Domain separation for the full-domain hash; the browser uses the same string
+	anonTokenDomain = "laporan-warga anonim token v1"
+)
+
+// Set from ANON_TOKEN_PUBLIC_KEY; nil disables anonim reports
+var anonTokenKey *rsa.PublicKey
+
+func initAnonTokens() error {
+	keyPEM := strings.TrimSpace(os.Getenv("ANON_TOKEN_PUBLIC_KEY"))
+	if keyPEM == "" {
+		log.Println("[ANON TOKEN] ANON_TOKEN_PUBLIC_KEY not set, anonim reports disabled")
+		return nil
+	}
+	block, _ := pem.Decode([]byte(keyPEM))
+	if block == nil {
+		return fmt.Errorf("invalid ANON_TOKEN_PUBLIC_KEY: not PEM")
+	}
+	key, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return fmt.Errorf("invalid ANON_TOKEN_PUBLIC_KEY: %v", err)
+	}
+	rsaKey, ok := key.(*rsa.PublicKey)
+	if !ok || rsaKey.N.BitLen() < 2048 {
+		return fmt.Errorf("invalid ANON_TOKEN_PUBLIC_KEY: need an RSA key of at least 2048 bits")
+	}
+	// anonTokenFDH clears only the top bit of a key-sized value, which is below n
+	// only when the modulus fills whole bytes
+	if rsaKey.N.BitLen()%8 != 0 {
+		return fmt.Errorf("invalid ANON_TOKEN_PUBLIC_KEY: modulus length must be a multiple of 8 bits")
+	}
+	anonTokenKey = rsaKey
+	return nil
+}
+
+// anonTokenFDH is the full-domain hash that is blinded and signed: MGF1-SHA384 of
+// SHA-384(domain || nonce), as long as the modulus with the top bit cleared so it is
+// always below n
+func anonTokenFDH(key *rsa.PublicKey, nonce []byte) *big.Int {
+	seed := sha512.Sum384(append([]byte(anonTokenDomain), nonce...))
+	out := make([]byte, 0, key.Size()+sha512.Size384)
+	var counter [4]byte
+	for i := uint32(0); len(out) < key.Size(); i++ {
+		binary.BigEndian.PutUint32(counter[:], i)
+		block := sha512.Sum384(append(seed[:], counter[:]...))
+		out = append(out, block[:]...)
+	}
+	out = out[:key.Size()]
+	out[0] &= 0x7f
+	return new(big.Int).SetBytes(out)
+}
+
+// verifyAnonToken checks the signature on a token and returns the hash it is stored
+// under once spent. It does not check whether the token was already spent.
+func verifyAnonToken(token string) (string, bool) {
+	if anonTokenKey == nil {
+		return "", false
+	}
+	parts := strings.Split(token, ".")
+	if len(parts) != 2 {
+		return "", false
+	}
+	nonce, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil || len(nonce) != anonTokenNonceBytes {
+		return "", false
+	}
+	sig, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil || len(sig) != anonTokenKey.Size() {
+		return "", false
+	}
+	s := new(big.Int).SetBytes(sig)
+	if s.Sign() == 0 || s.Cmp(anonTokenKey.N) >= 0 {
+		return "", false
+	}
+	if new(big.Int).Exp(s, big.NewInt(int64(anonTokenKey.E)), anonTokenKey.N).Cmp(anonTokenFDH(anonTokenKey, nonce)) != 0 {
+		return "", false
+	}
+	sum := sha256.Sum256(nonce)
+	return hex.EncodeToString(sum[:]), true
+}
+
+// spendAnonToken records a token as spent inside the report's transaction, so it is
+// only used up when the report is actually created. It returns false when the token
+// was spent before; a concurrent spend of the same token waits on the primary key.
+func spendAnonToken(tx *sql.Tx, tokenHash string) (bool, error) {
+	result, err := tx.Exec(`INSERT INTO spent_anon_tokens (token_hash) VALUES ($1) ON CONFLICT DO NOTHING`, tokenHash)
+	if err != nil {
+		return false, err
+	}
+	n, err := result.RowsAffected()
+	return n == 1, err
+}
+
+// anonTokenOrAuthMiddleware lets a request carrying an anonim token and no access token
+// through without identity; createLaporanHandler then only accepts an anonim report.
+// Everything else goes through authMiddleware as before.
+func anonTokenOrAuthMiddleware(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") == "" && r.Header.Get(anonTokenHeader) != "" {
+			r.Header.Del("X-User-ID")
+			r.Header.Del("X-User-NIK")
+			r.Header.Del("X-User-Nama")
+			next(w, r)
+			return
+		}
+		authMiddleware(next)(w, r)
+	}
+}
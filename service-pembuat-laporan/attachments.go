@@ -0,0 +1,748 @@
+package main
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/lib/pq"
+)
+
+// Attachment configuration (see initAttachments)
+var attachmentStore AttachmentStore
+var maxAttachmentBytes int64
+var maxAttachmentsPerLaporan int
+var attachmentURLSecret []byte
+var attachmentURLTTL time.Duration
+
+// Public path prefix the ingress maps to this service, used to build download URLs
+var publicAPIPrefix string
+
+// Allowed attachment types, detected from magic bytes (never from the client's
+// Content-Type or file extension), mapped to the extension we store them with
+var allowedAttachmentTypes = map[string]string{
+	"image/jpeg":      ".jpg",
+	"image/png":       ".png",
+	"image/webp":      ".webp",
+	"application/pdf": ".pdf",
+}
+
+// Attachment is the metadata returned to clients; storage keys are never exposed
+type Attachment struct {
+	ID          int                 `json:"id"`
+	Filename    string              `json:"filename"`
+	ContentType string              `json:"content_type"`
+	Size        int64               `json:"size"`
+	Width       int                 `json:"width,omitempty"`
+	Height      int                 `json:"height,omitempty"`
+	URL         string              `json:"url"`
+	Thumbnails  map[string]string   `json:"thumbnails,omitempty"` // longest edge in px -> URL
+	Location    *AttachmentLocation `json:"location,omitempty"`
+	CreatedAt   time.Time           `json:"created_at"`
+}
+
+// AttachmentLocation is the GPS position taken from a publik photo's EXIF,
+// only stored when the reporter gave location consent
+type AttachmentLocation struct {
+	Latitude  float64 `json:"latitude"`
+	Longitude float64 `json:"longitude"`
+}
+
+// uploadedFile is a validated upload held in memory until it is stored.
+// Images have already been through sanitizeImage, so Data carries no metadata.
+type uploadedFile struct {
+	Filename    string
+	ContentType string
+	Data        []byte
+	Width       int
+	Height      int
+	Thumbnails  map[int][]byte
+	Location    *gpsLocation
+}
+
+// uploadError carries the status and code to send when an upload is rejected
+type uploadError struct {
+	Status  int
+	Code    string
+	Message string
+	Field   string
+}
+
+func initAttachments() error {
+	maxMB, err := strconv.Atoi(getEnv("ATTACHMENT_MAX_MB", "5"))
+	if err != nil || maxMB <= 0 {
+		return fmt.Errorf("invalid ATTACHMENT_MAX_MB")
+	}
+	maxAttachmentBytes = int64(maxMB) << 20
+
+	maxAttachmentsPerLaporan, err = strconv.Atoi(getEnv("ATTACHMENT_MAX_PER_LAPORAN", "5"))
+	if err != nil || maxAttachmentsPerLaporan <= 0 {
+		return fmt.Errorf("invalid ATTACHMENT_MAX_PER_LAPORAN")
+	}
+
+	attachmentURLSecret = []byte(getEnv("ATTACHMENT_URL_SECRET", "your-attachment-url-secret"))
+	attachmentURLTTL, err = parseDuration(getEnv("ATTACHMENT_URL_TTL", "15m"))
+	if err != nil {
+		return fmt.Errorf("invalid ATTACHMENT_URL_TTL: %w", err)
+	}
+	publicAPIPrefix = strings.TrimRight(getEnv("PUBLIC_API_PREFIX", "/api/warga"), "/")
+
+	if err := initImaging(); err != nil {
+		return err
+	}
+
+	attachmentStore, err = newAttachmentStoreFromEnv()
+	return err
+}
+
+// maxUploadRequestBytes bounds a whole multipart request: every file plus form overhead
+func maxUploadRequestBytes() int64 {
+	return int64(maxAttachmentsPerLaporan)*maxAttachmentBytes + 1<<20
+}
+
+// parseUploadForm parses a multipart body bounded by maxUploadRequestBytes.
+// On failure it writes the error response and returns false.
+func parseUploadForm(w http.ResponseWriter, r *http.Request) bool {
+	r.Body = http.MaxBytesReader(w, r.Body, maxUploadRequestBytes())
+	err := r.ParseMultipartForm(8 << 20)
+	if err == nil {
+		return true
+	}
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		writeError(w, http.StatusRequestEntityTooLarge, ErrCodeAttachmentTooLarge, "Request body is too large")
+		return false
+	}
+	log.Println("[UPLOAD ERROR] Invalid multipart body:", err)
+	writeError(w, http.StatusBadRequest, ErrCodeInvalidRequestBody, "Expected multipart/form-data")
+	return false
+}
+
+// readUploads validates the "attachments" parts of a parsed multipart form.
+// locationConsent allows GPS to be kept from publik photos; it is ignored for other tipes.
+func readUploads(form *multipart.Form, tipe string, existing int, locationConsent bool) ([]uploadedFile, *uploadError) {
+	if form == nil {
+		return nil, nil
+	}
+	headers := form.File["attachments"]
+	if existing+len(headers) > maxAttachmentsPerLaporan {
+		return nil, &uploadError{
+			Status:  http.StatusBadRequest,
+			Code:    ErrCodeTooManyAttachments,
+			Message: fmt.Sprintf("A laporan can have at most %d attachments", maxAttachmentsPerLaporan),
+			Field:   "attachments",
+		}
+	}
+
+	var files []uploadedFile
+	for _, fh := range headers {
+		file, uerr := readUpload(fh, tipe, tipe == "publik" && locationConsent)
+		if uerr != nil {
+			return nil, uerr
+		}
+		files = append(files, file)
+	}
+	return files, nil
+}
+
+func readUpload(fh *multipart.FileHeader, tipe string, extractGPS bool) (uploadedFile, *uploadError) {
+	tooLarge := &uploadError{
+		Status:  http.StatusRequestEntityTooLarge,
+		Code:    ErrCodeAttachmentTooLarge,
+		Message: fmt.Sprintf("Each attachment must be at most %d MB", maxAttachmentBytes>>20),
+		Field:   "attachments",
+	}
+	if fh.Size > maxAttachmentBytes {
+		return uploadedFile{}, tooLarge
+	}
+
+	f, err := fh.Open()
+	if err != nil {
+		return uploadedFile{}, &uploadError{Status: http.StatusBadRequest, Code: ErrCodeInvalidRequestBody, Message: "Could not read attachment", Field: "attachments"}
+	}
+	defer f.Close()
+
+	data, err := io.ReadAll(io.LimitReader(f, maxAttachmentBytes+1))
+	if err != nil {
+		return uploadedFile{}, &uploadError{Status: http.StatusBadRequest, Code: ErrCodeInvalidRequestBody, Message: "Could not read attachment", Field: "attachments"}
+	}
+	if int64(len(data)) > maxAttachmentBytes {
+		return uploadedFile{}, tooLarge
+	}
+
+	contentType := http.DetectContentType(data)
+	ext, ok := allowedAttachmentTypes[contentType]
+	if !ok {
+		return uploadedFile{}, &uploadError{
+			Status:  http.StatusUnsupportedMediaType,
+			Code:    ErrCodeAttachmentTypeNotAllowed,
+			Message: "Attachments must be JPEG, PNG, WebP or PDF",
+			Field:   "attachments",
+		}
+	}
+
+	if !isSanitizableImage(contentType) {
+		// PDFs cannot be re-encoded, and their Info dictionary and XMP (author, creator
+		// tool, creation date) can name the reporter, so only publik reports take them
+		if tipe != "publik" {
+			return uploadedFile{}, &uploadError{
+				Status:  http.StatusUnsupportedMediaType,
+				Code:    ErrCodeAttachmentTypeNotAllowed,
+				Message: "Attachments on private and anonim reports must be JPEG, PNG or WebP",
+				Field:   "attachments",
+			}
+		}
+		return uploadedFile{
+			Filename:    attachmentFilename(fh.Filename, tipe, ext),
+			ContentType: contentType,
+			Data:        data,
+		}, nil
+	}
+
+	// Never store the bytes as uploaded: EXIF can hold GPS, device serials and timestamps
+	img, err := sanitizeImage(data, contentType, extractGPS)
+	if err != nil {
+		log.Println("[UPLOAD] Rejected image:", err)
+		return uploadedFile{}, &uploadError{
+			Status:  http.StatusBadRequest,
+			Code:    ErrCodeAttachmentInvalidImage,
+			Message: "Image could not be processed",
+			Field:   "attachments",
+		}
+	}
+	ext = allowedAttachmentTypes[img.ContentType]
+	return uploadedFile{
+		Filename:    attachmentFilename(strings.TrimSuffix(fh.Filename, filepath.Ext(fh.Filename))+ext, tipe, ext),
+		ContentType: img.ContentType,
+		Data:        img.Data,
+		Width:       img.Width,
+		Height:      img.Height,
+		Thumbnails:  img.Thumbnails,
+		Location:    img.Location,
+	}, nil
+}
+
+// attachmentFilename sanitizes the client's file name. Anonim reports never keep
+// the original name since it can identify the reporter (e.g. "IMG_Budi_rumah.jpg").
+func attachmentFilename(original, tipe, ext string) string {
+	if tipe == "anonim" {
+		return "lampiran" + ext
+	}
+	name := strings.Map(func(r rune) rune {
+		if unicode.IsControl(r) || r == '"' || r == '\\' || r == '/' {
+			return -1
+		}
+		return r
+	}, filepath.Base(original))
+	name = strings.TrimSpace(name)
+	if name == "" || name == "." {
+		return "lampiran" + ext
+	}
+	if len(name) > 200 {
+		name = name[:200]
+	}
+	return name
+}
+
+// saveAttachments stores each file and records its metadata inside tx.
+// It returns the storage keys written so the caller can clean up if tx is rolled back.
+func saveAttachments(ctx context.Context, tx *sql.Tx, laporanID int, tipe string, files []uploadedFile) ([]Attachment, []string, error) {
+	var attachments []Attachment
+	var keys []string
+	for _, f := range files {
+		key, err := newStorageKey(laporanID, allowedAttachmentTypes[f.ContentType])
+		if err != nil {
+			return nil, keys, err
+		}
+		if err := attachmentStore.Put(ctx, key, f.Data, f.ContentType); err != nil {
+			return nil, keys, fmt.Errorf("store attachment: %w", err)
+		}
+		keys = append(keys, key)
+
+		var sizes []int64
+		for _, size := range thumbnailSizes {
+			thumb, ok := f.Thumbnails[size]
+			if !ok {
+				continue
+			}
+			thumbKey := thumbnailKey(key, size)
+			if err := attachmentStore.Put(ctx, thumbKey, thumb, "image/jpeg"); err != nil {
+				return nil, keys, fmt.Errorf("store thumbnail: %w", err)
+			}
+			keys = append(keys, thumbKey)
+			sizes = append(sizes, int64(size))
+		}
+
+		a := Attachment{Filename: f.Filename, ContentType: f.ContentType, Size: int64(len(f.Data)), Width: f.Width, Height: f.Height}
+		var lat, lng sql.NullFloat64
+		if f.Location != nil {
+			a.Location = &AttachmentLocation{Latitude: f.Location.Latitude, Longitude: f.Location.Longitude}
+			lat = sql.NullFloat64{Float64: f.Location.Latitude, Valid: true}
+			lng = sql.NullFloat64{Float64: f.Location.Longitude, Valid: true}
+		}
+		err = tx.QueryRow(`
+			INSERT INTO laporan_attachments
+				(laporan_id, storage_key, filename, content_type, size_bytes, sha256, width, height, thumbnail_sizes, latitude, longitude)
+			VALUES ($1, $2, $3, $4, $5, $6, NULLIF($7, 0), NULLIF($8, 0), $9, $10, $11)
+			RETURNING id, created_at
+		`, laporanID, key, f.Filename, f.ContentType, a.Size, sha256Hex(f.Data),
+			f.Width, f.Height, pq.Array(sizes), lat, lng).Scan(&a.ID, &a.CreatedAt)
+		if err != nil {
+			return nil, keys, fmt.Errorf("insert attachment metadata: %w", err)
+		}
+		a.URL = attachmentURL(a.ID, tipe, 0)
+		a.Thumbnails = thumbnailURLs(a.ID, tipe, sizes)
+		attachments = append(attachments, a)
+	}
+	return attachments, keys, nil
+}
+
+// deleteStoredObjects removes objects written for a transaction that was rolled back
+func deleteStoredObjects(keys []string) {
+	for _, key := range keys {
+		if err := attachmentStore.Delete(context.Background(), key); err != nil {
+			log.Println("[ATTACHMENT ERROR] Failed to clean up object after rollback:", err)
+		}
+	}
+}
+
+// newStorageKey returns an unguessable key; object names never reveal who uploaded them
+func newStorageKey(laporanID int, ext string) (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("laporan/%d/%s%s", laporanID, hex.EncodeToString(b), ext), nil
+}
+
+// thumbnailKey derives the storage key of a thumbnail from its original's key
+func thumbnailKey(key string, size int) string {
+	return fmt.Sprintf("%s_%d.jpg", strings.TrimSuffix(key, filepath.Ext(key)), size)
+}
+
+// attachmentURL builds the download URL, for a thumbnail when size > 0. Publik
+// attachments get a plain URL; everything else gets a short-lived signed URL so
+// it works in <img src> without headers.
+func attachmentURL(attachmentID int, tipe string, size int) string {
+	prefix := publicAPIPrefix
+	// Downloads of anonim attachments go through the anonim path too, so they are not access-logged
+	if tipe == "anonim" {
+		prefix += anonimPathPrefix
+	}
+	u := fmt.Sprintf("%s/laporan/attachments/%d", prefix, attachmentID)
+	sep := "?"
+	if size > 0 {
+		u += fmt.Sprintf("?size=%d", size)
+		sep = "&"
+	}
+	if tipe == "publik" {
+		return u
+	}
+	expires := time.Now().Add(attachmentURLTTL).Unix()
+	return fmt.Sprintf("%s%sexpires=%d&signature=%s", u, sep, expires, attachmentSignature(attachmentID, expires))
+}
+
+// thumbnailURLs maps each stored thumbnail size to its download URL
+func thumbnailURLs(attachmentID int, tipe string, sizes []int64) map[string]string {
+	if len(sizes) == 0 {
+		return nil
+	}
+	urls := make(map[string]string, len(sizes))
+	for _, size := range sizes {
+		urls[strconv.FormatInt(size, 10)] = attachmentURL(attachmentID, tipe, int(size))
+	}
+	return urls
+}
+
+func attachmentSignature(attachmentID int, expires int64) string {
+	mac := hmac.New(sha256.New, attachmentURLSecret)
+	fmt.Fprintf(mac, "attachment:%d:%d", attachmentID, expires)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// validAttachmentSignature checks an unexpired signature for attachmentID
+func validAttachmentSignature(attachmentID int, expiresParam, signature string) bool {
+	expires, err := strconv.ParseInt(expiresParam, 10, 64)
+	if err != nil || time.Now().Unix() > expires {
+		return false
+	}
+	expected := attachmentSignature(attachmentID, expires)
+	return subtle.ConstantTimeCompare([]byte(expected), []byte(signature)) == 1
+}
+
+// laporanOwner is the minimum needed to decide who may see or change a laporan
+type laporanOwner struct {
+	ID      int
+	Tipe    string
+	UserNik string
+	// TrackingCodeHash is set on anonim reports that use a tracking code; UserNik is
+	// then empty. Older anonim reports keep the client-side hash in UserNik.
+	TrackingCodeHash string
+}
+
+func loadLaporanOwner(id int) (*laporanOwner, error) {
+	var o laporanOwner
+	var userNik, trackingCodeHash sql.NullString
+	err := db.QueryRow(`SELECT id, tipe, user_nik, tracking_code_hash FROM laporan WHERE id = $1`, id).
+		Scan(&o.ID, &o.Tipe, &userNik, &trackingCodeHash)
+	if err != nil {
+		return nil, err
+	}
+	o.UserNik = userNik.String
+	o.TrackingCodeHash = trackingCodeHash.String
+	return &o, nil
+}
+
+// isOwner reports whether the caller owns the laporan: the token NIK for
+// publik/private; for anonim reports the tracking code, or the anonim credential
+// header on reports that were never moved to a tracking code
+func (o *laporanOwner) isOwner(r *http.Request) bool {
+	stored, credential := o.UserNik, r.Header.Get("X-User-NIK")
+	if o.Tipe == "anonim" {
+		stored, credential = o.UserNik, r.Header.Get(anonCredentialHeader)
+		if o.TrackingCodeHash != "" {
+			stored, credential = o.TrackingCodeHash, hashTrackingCode(r.Header.Get(trackingCodeHeader))
+		}
+	}
+	return stored != "" && credential != "" && subtle.ConstantTimeCompare([]byte(credential), []byte(stored)) == 1
+}
+
+// ownerID is the stored identity of the owner, used as the author id of their comments
+func (o *laporanOwner) ownerID() string {
+	if o.TrackingCodeHash != "" {
+		return o.TrackingCodeHash
+	}
+	return o.UserNik
+}
+
+// canView applies tipe visibility: publik to anyone, private/anonim to the owner only
+func (o *laporanOwner) canView(r *http.Request) bool {
+	return o.Tipe == "publik" || o.isOwner(r)
+}
+
+// parseLaporanID parses a path segment as a positive laporan or attachment id
+func parseLaporanID(segment string) (int, bool) {
+	id, err := strconv.Atoi(segment)
+	return id, err == nil && id > 0
+}
+
+// laporanItemRouter dispatches everything under /laporan/ that is not matched by an
+// exact route (/laporan/public, /laporan/my)
+func laporanItemRouter(w http.ResponseWriter, r *http.Request) {
+	parts := strings.Split(strings.Trim(strings.TrimPrefix(r.URL.Path, "/laporan/"), "/"), "/")
+
+	switch {
+	// /laporan/{id}
+	case len(parts) == 1:
+		laporanID, ok := parseLaporanID(parts[0])
+		if !ok {
+			break
+		}
+		switch r.Method {
+		case http.MethodGet:
+			optionalAuthMiddleware(func(w http.ResponseWriter, r *http.Request) {
+				getLaporanDetailHandler(w, r, laporanID)
+			})(w, r)
+		case http.MethodPatch:
+			trackingCodeOrAuthMiddleware(func(w http.ResponseWriter, r *http.Request) {
+				updateLaporanHandler(w, r, laporanID)
+			})(w, r)
+		case http.MethodDelete:
+			trackingCodeOrAuthMiddleware(func(w http.ResponseWriter, r *http.Request) {
+				withdrawLaporanHandler(w, r, laporanID)
+			})(w, r)
+		default:
+			writeMethodNotAllowed(w)
+		}
+		return
+
+	// /laporan/attachments/{attachmentId}
+	case len(parts) == 2 && parts[0] == "attachments":
+		attachmentID, ok := parseLaporanID(parts[1])
+		if !ok {
+			break
+		}
+		downloadAttachmentHandler(w, r, attachmentID)
+		return
+
+	// /laporan/{id}/attachments
+	case len(parts) == 2 && parts[1] == "attachments":
+		laporanID, ok := parseLaporanID(parts[0])
+		if !ok {
+			break
+		}
+		switch r.Method {
+		case http.MethodGet:
+			optionalAuthMiddleware(func(w http.ResponseWriter, r *http.Request) {
+				listAttachmentsHandler(w, r, laporanID)
+			})(w, r)
+		case http.MethodPost:
+			trackingCodeOrAuthMiddleware(func(w http.ResponseWriter, r *http.Request) {
+				uploadAttachmentsHandler(w, r, laporanID)
+			})(w, r)
+		default:
+			writeMethodNotAllowed(w)
+		}
+		return
+
+	// /laporan/{id}/support
+	case len(parts) == 2 && parts[1] == "support":
+		laporanID, ok := parseLaporanID(parts[0])
+		if !ok {
+			break
+		}
+		if r.Method != http.MethodPut && r.Method != http.MethodDelete {
+			writeMethodNotAllowed(w)
+			return
+		}
+		authMiddleware(func(w http.ResponseWriter, r *http.Request) {
+			supportLaporanHandler(w, r, laporanID)
+		})(w, r)
+		return
+
+	// /laporan/{id}/comments
+	case len(parts) == 2 && parts[1] == "comments":
+		laporanID, ok := parseLaporanID(parts[0])
+		if !ok {
+			break
+		}
+		switch r.Method {
+		case http.MethodGet:
+			optionalCommenterAuthMiddleware(func(w http.ResponseWriter, r *http.Request) {
+				listCommentsHandler(w, r, laporanID)
+			})(w, r)
+		case http.MethodPost:
+			commenterAuthMiddleware(func(w http.ResponseWriter, r *http.Request) {
+				createCommentHandler(w, r, laporanID)
+			})(w, r)
+		default:
+			writeMethodNotAllowed(w)
+		}
+		return
+
+	// /laporan/{id}/comments/{commentId} and /laporan/{id}/comments/{commentId}/flags
+	case (len(parts) == 3 || (len(parts) == 4 && parts[3] == "flags")) && parts[1] == "comments":
+		laporanID, ok := parseLaporanID(parts[0])
+		commentID, ok2 := parseLaporanID(parts[2])
+		if !ok || !ok2 {
+			break
+		}
+		switch {
+		case len(parts) == 3 && r.Method == http.MethodPatch:
+			commenterAuthMiddleware(func(w http.ResponseWriter, r *http.Request) {
+				updateCommentHandler(w, r, laporanID, commentID)
+			})(w, r)
+		case len(parts) == 4 && r.Method == http.MethodPost:
+			commenterAuthMiddleware(func(w http.ResponseWriter, r *http.Request) {
+				flagCommentHandler(w, r, laporanID, commentID)
+			})(w, r)
+		default:
+			writeMethodNotAllowed(w)
+		}
+		return
+	}
+
+	writeError(w, http.StatusNotFound, ErrCodeNotFound, "Not found")
+}
+
+// POST /laporan/{id}/attachments - Add attachments to an existing report (owner only)
+func uploadAttachmentsHandler(w http.ResponseWriter, r *http.Request, laporanID int) {
+	owner, err := loadLaporanOwner(laporanID)
+	if err != nil || !owner.isOwner(r) {
+		// 404 for both missing and not-owned so report existence isn't leaked
+		if err != nil && !errors.Is(err, sql.ErrNoRows) {
+			log.Println("[UPLOAD ATTACHMENT ERROR] Database error:", err)
+		}
+		writeError(w, http.StatusNotFound, ErrCodeLaporanNotFound, "Laporan not found")
+		return
+	}
+
+	if !parseUploadForm(w, r) {
+		return
+	}
+	defer r.MultipartForm.RemoveAll()
+
+	var existing int
+	if err := db.QueryRow(`SELECT COUNT(*) FROM laporan_attachments WHERE laporan_id = $1`, laporanID).Scan(&existing); err != nil {
+		log.Println("[UPLOAD ATTACHMENT ERROR] Count error:", err)
+		writeError(w, http.StatusInternalServerError, ErrCodeInternal, "Failed to upload attachments")
+		return
+	}
+
+	files, uerr := readUploads(r.MultipartForm, owner.Tipe, existing, r.FormValue("locationConsent") == "true")
+	if uerr != nil {
+		writeFieldError(w, uerr.Status, uerr.Code, uerr.Message, map[string]string{uerr.Field: uerr.Message})
+		return
+	}
+	if len(files) == 0 {
+		writeFieldError(w, http.StatusBadRequest, ErrCodeValidationFailed, "At least one attachment is required", map[string]string{"attachments": "required"})
+		return
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		log.Println("[UPLOAD ATTACHMENT ERROR] Begin transaction:", err)
+		writeError(w, http.StatusInternalServerError, ErrCodeInternal, "Failed to upload attachments")
+		return
+	}
+	attachments, keys, err := saveAttachments(r.Context(), tx, laporanID, owner.Tipe, files)
+	if err == nil {
+		err = tx.Commit()
+	} else {
+		tx.Rollback()
+	}
+	if err != nil {
+		log.Println("[UPLOAD ATTACHMENT ERROR]", err)
+		deleteStoredObjects(keys)
+		writeError(w, http.StatusInternalServerError, ErrCodeInternal, "Failed to upload attachments")
+		return
+	}
+
+	logRequestf(r, "[UPLOAD ATTACHMENT SUCCESS] Added %d attachment(s) to laporan %d\n", len(attachments), laporanID)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(attachments)
+}
+
+// GET /laporan/{id}/attachments - List attachments with download URLs (tipe visibility applies)
+func listAttachmentsHandler(w http.ResponseWriter, r *http.Request, laporanID int) {
+	owner, err := loadLaporanOwner(laporanID)
+	if err != nil || !owner.canView(r) {
+		if err != nil && !errors.Is(err, sql.ErrNoRows) {
+			log.Println("[LIST ATTACHMENT ERROR] Database error:", err)
+		}
+		writeError(w, http.StatusNotFound, ErrCodeLaporanNotFound, "Laporan not found")
+		return
+	}
+
+	attachments, err := loadAttachments(laporanID, owner.Tipe)
+	if err != nil {
+		log.Println("[LIST ATTACHMENT ERROR] Database error:", err)
+		writeError(w, http.StatusInternalServerError, ErrCodeInternal, "Failed to fetch attachments")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(attachments)
+}
+
+// loadAttachments returns attachment metadata with freshly built download URLs
+func loadAttachments(laporanID int, tipe string) ([]Attachment, error) {
+	rows, err := db.Query(`
+		SELECT id, filename, content_type, size_bytes, COALESCE(width, 0), COALESCE(height, 0),
+		       thumbnail_sizes, latitude, longitude, created_at
+		FROM laporan_attachments
+		WHERE laporan_id = $1
+		ORDER BY id
+	`, laporanID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	attachments := []Attachment{}
+	for rows.Next() {
+		var a Attachment
+		var sizes []int64
+		var lat, lng sql.NullFloat64
+		if err := rows.Scan(&a.ID, &a.Filename, &a.ContentType, &a.Size, &a.Width, &a.Height,
+			pq.Array(&sizes), &lat, &lng, &a.CreatedAt); err != nil {
+			return nil, err
+		}
+		a.URL = attachmentURL(a.ID, tipe, 0)
+		a.Thumbnails = thumbnailURLs(a.ID, tipe, sizes)
+		// GPS is only ever stored for publik reports, but never hand it out for any other tipe
+		if lat.Valid && lng.Valid && tipe == "publik" {
+			a.Location = &AttachmentLocation{Latitude: lat.Float64, Longitude: lng.Float64}
+		}
+		attachments = append(attachments, a)
+	}
+	return attachments, rows.Err()
+}
+
+// GET /laporan/attachments/{attachmentId}[?size=N] - Download an attachment or one of its thumbnails
+// Publik attachments are open; others need a valid signature from attachmentURL.
+func downloadAttachmentHandler(w http.ResponseWriter, r *http.Request, attachmentID int) {
+	if r.Method != http.MethodGet {
+		writeMethodNotAllowed(w)
+		return
+	}
+
+	var key, filename, contentType, tipe string
+	var sizes []int64
+	err := db.QueryRow(`
+		SELECT a.storage_key, a.filename, a.content_type, a.thumbnail_sizes, l.tipe
+		FROM laporan_attachments a
+		JOIN laporan l ON l.id = a.laporan_id
+		WHERE a.id = $1
+	`, attachmentID).Scan(&key, &filename, &contentType, pq.Array(&sizes), &tipe)
+	if err != nil {
+		if !errors.Is(err, sql.ErrNoRows) {
+			log.Println("[DOWNLOAD ATTACHMENT ERROR] Database error:", err)
+		}
+		writeError(w, http.StatusNotFound, ErrCodeAttachmentNotFound, "Attachment not found")
+		return
+	}
+
+	query := r.URL.Query()
+	if tipe != "publik" && !validAttachmentSignature(attachmentID, query.Get("expires"), query.Get("signature")) {
+		writeError(w, http.StatusNotFound, ErrCodeAttachmentNotFound, "Attachment not found")
+		return
+	}
+
+	if sizeParam := query.Get("size"); sizeParam != "" {
+		size, err := strconv.ParseInt(sizeParam, 10, 64)
+		found := false
+		for _, s := range sizes {
+			found = found || (err == nil && s == size)
+		}
+		if !found {
+			writeError(w, http.StatusNotFound, ErrCodeAttachmentNotFound, "Thumbnail not found")
+			return
+		}
+		key = thumbnailKey(key, int(size))
+		contentType = "image/jpeg"
+		filename = strings.TrimSuffix(filename, filepath.Ext(filename)) + fmt.Sprintf("_%d.jpg", size)
+	}
+
+	obj, err := attachmentStore.Get(r.Context(), key)
+	if err != nil {
+		if !errors.Is(err, ErrObjectNotFound) {
+			log.Println("[DOWNLOAD ATTACHMENT ERROR] Storage error:", err)
+		}
+		writeError(w, http.StatusNotFound, ErrCodeAttachmentNotFound, "Attachment not found")
+		return
+	}
+	defer obj.Close()
+
+	disposition := "inline"
+	if !strings.HasPrefix(contentType, "image/") {
+		disposition = "attachment"
+	}
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Content-Disposition", mime.FormatMediaType(disposition, map[string]string{"filename": filename}))
+	if tipe == "publik" {
+		w.Header().Set("Cache-Control", "public, max-age=3600")
+	} else {
+		w.Header().Set("Cache-Control", "private, no-store")
+	}
+	io.Copy(w, obj)
+}
@@ -0,0 +1,681 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/lib/pq"
+)
+
+// Comment visibility: public threads are readable by anyone on publik reports,
+// private threads are between the reporter and the officers of the report's divisi
+const (
+	commentPublic  = "public"
+	commentPrivate = "private"
+)
+
+// Who wrote a comment (laporan_comments.author_type)
+const (
+	commentAuthorReporter = "reporter" // the report's owner, including anonim reporters
+	commentAuthorWarga    = "warga"    // any other warga, public threads only
+	commentAuthorOfficer  = "officer"  // an admin of the report's divisi
+)
+
+// Moderation states (laporan_comments.moderation_status). flagged is set
+// automatically once enough users report a comment; hidden is set by an officer.
+const (
+	moderationVisible = "visible"
+	moderationFlagged = "flagged"
+	moderationHidden  = "hidden"
+)
+
+const (
+	maxCommentLength    = 2000
+	maxFlagReasonLength = 200
+)
+
+// Set from COMMENT_EDIT_WINDOW and COMMENT_FLAG_THRESHOLD
+var commentEditWindow time.Duration
+var commentFlagThreshold int
+
+func initComments() error {
+	var err error
+	commentEditWindow, err = parseDuration(getEnv("COMMENT_EDIT_WINDOW", "15m"))
+	if err != nil || commentEditWindow < 0 {
+		return fmt.Errorf("invalid COMMENT_EDIT_WINDOW")
+	}
+	commentFlagThreshold, err = strconv.Atoi(getEnv("COMMENT_FLAG_THRESHOLD", "3"))
+	if err != nil || commentFlagThreshold < 1 {
+		return fmt.Errorf("invalid COMMENT_FLAG_THRESHOLD")
+	}
+	return nil
+}
+
+// officerClaims is the access token issued by service-auth-admin
+type officerClaims struct {
+	UserNip string `json:"userNip"`
+	Nama    string `json:"nama"`
+	Divisi  string `json:"divisi"`
+	Role    string `json:"role"` // hardcoded as 'admin'
+	jwt.RegisteredClaims
+}
+
+// officerFromToken returns the claims when the request carries a valid admin token
+func officerFromToken(r *http.Request) (*officerClaims, bool) {
+	authHeader := r.Header.Get("Authorization")
+	if !strings.HasPrefix(authHeader, "Bearer ") {
+		return nil, false
+	}
+	claims := &officerClaims{}
+	token, err := jwt.ParseWithClaims(strings.TrimPrefix(authHeader, "Bearer "), claims, jwtKeyFunc)
+	if err != nil || !token.Valid || claims.Role != "admin" || claims.UserNip == "" || !validDivisi[claims.Divisi] {
+		return nil, false
+	}
+	return claims, true
+}
+
+// setOfficerHeaders stores the officer identity the same way authMiddleware stores a warga's.
+// X-User-* are cleared so an officer can never pass as a warga or report owner.
+func setOfficerHeaders(r *http.Request, claims *officerClaims) {
+	r.Header.Del("X-User-ID")
+	r.Header.Del("X-User-NIK")
+	r.Header.Del("X-User-Nama")
+	r.Header.Set("X-Officer-NIP", claims.UserNip)
+	r.Header.Set("X-Officer-Nama", claims.Nama)
+	r.Header.Set("X-Officer-Divisi", claims.Divisi)
+}
+
+func clearOfficerHeaders(r *http.Request) {
+	r.Header.Del("X-Officer-NIP")
+	r.Header.Del("X-Officer-Nama")
+	r.Header.Del("X-Officer-Divisi")
+}
+
+// commenterAuthMiddleware accepts either a warga token (checked by authMiddleware)
+// or an officer token from service-auth-admin. An anonim reporter may instead send
+// only a tracking code; loadCommentContext then decides whether it owns the report.
+func commenterAuthMiddleware(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		clearOfficerHeaders(r)
+		if claims, ok := officerFromToken(r); ok {
+			log.Printf("[AUTH SUCCESS] Officer verified: %s (divisi: %s)\n", claims.UserNip, claims.Divisi)
+			setOfficerHeaders(r, claims)
+			next(w, r)
+			return
+		}
+		trackingCodeOrAuthMiddleware(next)(w, r)
+	}
+}
+
+// optionalCommenterAuthMiddleware is the optionalAuthMiddleware counterpart of commenterAuthMiddleware
+func optionalCommenterAuthMiddleware(next http.HandlerFunc) http.HandlerFunc {
+	return optionalAuthMiddleware(func(w http.ResponseWriter, r *http.Request) {
+		clearOfficerHeaders(r)
+		if claims, ok := officerFromToken(r); ok {
+			setOfficerHeaders(r, claims)
+		}
+		next(w, r)
+	})
+}
+
+// commentContext is a laporan plus what the caller may do with its comments
+type commentContext struct {
+	Owner           laporanOwner
+	Divisi          string
+	Status          string
+	ReporterDisplay sql.NullString
+	// Caller identity as stored in author_type/author_id; empty for anonymous readers
+	AuthorType string
+	AuthorID   string
+	AuthorName string
+	IsOfficer  bool // officer of this report's divisi
+}
+
+// canSeePrivate reports whether the caller takes part in private threads
+func (c *commentContext) canSeePrivate() bool {
+	return c.IsOfficer || c.AuthorType == commentAuthorReporter
+}
+
+// visibilities returns the thread types the caller can read
+func (c *commentContext) visibilities() []string {
+	var v []string
+	if c.Owner.Tipe == "publik" {
+		v = append(v, commentPublic)
+	}
+	if c.canSeePrivate() {
+		v = append(v, commentPrivate)
+	}
+	return v
+}
+
+// loadCommentContext loads the laporan and works out who the caller is.
+// It writes a 404 and returns nil when the caller may not see the report.
+func loadCommentContext(w http.ResponseWriter, r *http.Request, laporanID int, tag string) *commentContext {
+	var c commentContext
+	var userNik, trackingCodeHash sql.NullString
+	err := db.QueryRow(`SELECT id, tipe, user_nik, tracking_code_hash, divisi, status, reporter_display FROM laporan WHERE id = $1`, laporanID).
+		Scan(&c.Owner.ID, &c.Owner.Tipe, &userNik, &trackingCodeHash, &c.Divisi, &c.Status, &c.ReporterDisplay)
+	if err != nil {
+		if !errors.Is(err, sql.ErrNoRows) {
+			log.Printf("[%s ERROR] Database error: %v\n", tag, err)
+			writeError(w, http.StatusInternalServerError, ErrCodeInternal, "Failed to load laporan")
+			return nil
+		}
+		writeError(w, http.StatusNotFound, ErrCodeLaporanNotFound, "Laporan not found")
+		return nil
+	}
+	c.Owner.UserNik = userNik.String
+	c.Owner.TrackingCodeHash = trackingCodeHash.String
+
+	switch {
+	case r.Header.Get("X-Officer-NIP") != "":
+		// Officers of other divisi get no more than an anonymous reader
+		if r.Header.Get("X-Officer-Divisi") == c.Divisi {
+			c.IsOfficer = true
+			c.AuthorType = commentAuthorOfficer
+			c.AuthorID = r.Header.Get("X-Officer-NIP")
+			c.AuthorName = strings.TrimSpace(r.Header.Get("X-Officer-Nama"))
+			if c.AuthorName == "" {
+				c.AuthorName = "Petugas"
+			}
+		}
+	case c.Owner.isOwner(r):
+		// Anonim reporters are identified by their tracking code or anonim credential only, never their NIK
+		c.AuthorType = commentAuthorReporter
+		c.AuthorID = c.Owner.ownerID()
+		c.AuthorName = "Pelapor"
+		if c.Owner.Tipe == "publik" {
+			c.AuthorName = anonymousReporterName
+			if c.ReporterDisplay.Valid {
+				c.AuthorName = c.ReporterDisplay.String
+			}
+		}
+	case r.Header.Get("X-User-NIK") != "":
+		c.AuthorType = commentAuthorWarga
+		c.AuthorID = r.Header.Get("X-User-NIK")
+		c.AuthorName = maskDisplayName(r.Header.Get("X-User-Nama"))
+	}
+
+	// Withdrawn reports stay visible to their owner and the handling officers only
+	if len(c.visibilities()) == 0 || (c.Status == statusWithdrawn && !c.canSeePrivate()) {
+		writeError(w, http.StatusNotFound, ErrCodeLaporanNotFound, "Laporan not found")
+		return nil
+	}
+	return &c
+}
+
+// Comment is one entry of a thread. Replies are only set on top-level comments.
+type Comment struct {
+	ID         int    `json:"id"`
+	ParentID   *int   `json:"parent_id,omitempty"`
+	Visibility string `json:"visibility"`
+	AuthorType string `json:"author_type"`
+	AuthorName string `json:"author_name"`
+	IsMine     bool   `json:"is_mine,omitempty"`
+	Body       string `json:"body,omitempty"`
+	// Hidden is true when moderation withholds the body from this caller
+	Hidden bool `json:"hidden,omitempty"`
+	// Moderation details, for officers and the comment's author only
+	ModerationStatus string `json:"moderation_status,omitempty"`
+	FlagCount        int    `json:"flag_count,omitempty"`
+	// Editable is true for the author while the edit window is open
+	Editable  bool       `json:"editable,omitempty"`
+	EditedAt  *time.Time `json:"edited_at,omitempty"`
+	CreatedAt time.Time  `json:"created_at"`
+	Replies   []Comment  `json:"replies,omitempty"`
+}
+
+// CommentListResponse is the paginated response for GET /laporan/{id}/comments.
+// Pagination counts top-level comments; each carries all of its replies.
+type CommentListResponse struct {
+	Data       []Comment `json:"data"`
+	Page       int       `json:"page"`
+	Limit      int       `json:"limit"`
+	TotalItems int       `json:"totalItems"`
+	TotalPages int       `json:"totalPages"`
+}
+
+// CreateCommentRequest is the POST /laporan/{id}/comments body
+type CreateCommentRequest struct {
+	Body       string `json:"body"`
+	Visibility string `json:"visibility"` // defaults to public on publik reports, private otherwise
+	ParentID   *int   `json:"parent_id"`
+}
+
+// UpdateCommentRequest is the PATCH /laporan/{id}/comments/{commentId} body.
+// Authors may change body; officers may set moderation_status.
+type UpdateCommentRequest struct {
+	Body             *string `json:"body"`
+	ModerationStatus *string `json:"moderation_status"`
+}
+
+const commentColumns = `id, parent_id, visibility, author_type, author_id, author_display, body,
+	moderation_status, flag_count, edited_at, created_at`
+
+// scanComment reads one commentColumns row and applies what the caller may see
+func scanComment(scan func(...interface{}) error, c *commentContext) (Comment, error) {
+	var cm Comment
+	var parentID sql.NullInt64
+	var authorID string
+	var editedAt sql.NullTime
+	if err := scan(&cm.ID, &parentID, &cm.Visibility, &cm.AuthorType, &authorID, &cm.AuthorName, &cm.Body,
+		&cm.ModerationStatus, &cm.FlagCount, &editedAt, &cm.CreatedAt); err != nil {
+		return cm, err
+	}
+	if parentID.Valid {
+		id := int(parentID.Int64)
+		cm.ParentID = &id
+	}
+	if editedAt.Valid {
+		cm.EditedAt = &editedAt.Time
+	}
+
+	cm.IsMine = c.AuthorType != "" && cm.AuthorType == c.AuthorType && authorID == c.AuthorID
+	cm.Editable = cm.IsMine && time.Since(cm.CreatedAt) < commentEditWindow
+	// Stored exactly for the edit window, but only shown coarsened on anonim reports
+	if c.Owner.Tipe == "anonim" {
+		cm.CreatedAt = coarseAnonTime(cm.CreatedAt)
+		if cm.EditedAt != nil {
+			edited := coarseAnonTime(*cm.EditedAt)
+			cm.EditedAt = &edited
+		}
+	}
+	if !c.IsOfficer && !cm.IsMine {
+		if cm.ModerationStatus != moderationVisible {
+			cm.Hidden = true
+			cm.Body = ""
+		}
+		cm.ModerationStatus = ""
+		cm.FlagCount = 0
+	} else if !c.IsOfficer {
+		cm.FlagCount = 0
+	}
+	return cm, nil
+}
+
+// GET /laporan/{id}/comments - Threads the caller can read
+// Query params: visibility (public|private), page, limit
+func listCommentsHandler(w http.ResponseWriter, r *http.Request, laporanID int) {
+	c := loadCommentContext(w, r, laporanID, "LIST COMMENTS")
+	if c == nil {
+		return
+	}
+
+	query := r.URL.Query()
+	visibilities := c.visibilities()
+	if v := query.Get("visibility"); v != "" {
+		if v != commentPublic && v != commentPrivate {
+			writeFieldError(w, http.StatusBadRequest, ErrCodeValidationFailed, "visibility must be one of: public, private", map[string]string{"visibility": "must be one of: public, private"})
+			return
+		}
+		var narrowed []string
+		for _, allowed := range visibilities {
+			if allowed == v {
+				narrowed = append(narrowed, v)
+			}
+		}
+		visibilities = narrowed
+	}
+	page, limit, offset := parsePagination(query)
+
+	var totalItems int
+	err := db.QueryRow(`
+		SELECT COUNT(*) FROM laporan_comments
+		WHERE laporan_id = $1 AND parent_id IS NULL AND visibility = ANY($2)
+	`, laporanID, pq.Array(visibilities)).Scan(&totalItems)
+	if err != nil {
+		log.Println("[LIST COMMENTS ERROR] Count query error:", err)
+		writeError(w, http.StatusInternalServerError, ErrCodeInternal, "Failed to fetch comments")
+		return
+	}
+
+	rows, err := db.Query(`
+		SELECT `+commentColumns+` FROM laporan_comments
+		WHERE laporan_id = $1 AND parent_id IS NULL AND visibility = ANY($2)
+		ORDER BY created_at ASC, id ASC
+		LIMIT $3 OFFSET $4
+	`, laporanID, pq.Array(visibilities), limit, offset)
+	if err != nil {
+		log.Println("[LIST COMMENTS ERROR] Database query error:", err)
+		writeError(w, http.StatusInternalServerError, ErrCodeInternal, "Failed to fetch comments")
+		return
+	}
+	defer rows.Close()
+
+	comments := []Comment{}
+	index := map[int]int{}
+	var rootIDs []int
+	for rows.Next() {
+		cm, err := scanComment(rows.Scan, c)
+		if err != nil {
+			log.Println("[LIST COMMENTS ERROR] Scan error:", err)
+			continue
+		}
+		index[cm.ID] = len(comments)
+		rootIDs = append(rootIDs, cm.ID)
+		comments = append(comments, cm)
+	}
+
+	if len(rootIDs) > 0 {
+		replies, err := db.Query(`
+			SELECT `+commentColumns+` FROM laporan_comments
+			WHERE parent_id = ANY($1)
+			ORDER BY created_at ASC, id ASC
+		`, pq.Array(rootIDs))
+		if err != nil {
+			log.Println("[LIST COMMENTS ERROR] Replies query error:", err)
+			writeError(w, http.StatusInternalServerError, ErrCodeInternal, "Failed to fetch comments")
+			return
+		}
+		defer replies.Close()
+		for replies.Next() {
+			cm, err := scanComment(replies.Scan, c)
+			if err != nil {
+				log.Println("[LIST COMMENTS ERROR] Reply scan error:", err)
+				continue
+			}
+			root := &comments[index[*cm.ParentID]]
+			root.Replies = append(root.Replies, cm)
+		}
+	}
+
+	totalPages := (totalItems + limit - 1) / limit
+
+	w.Header().Set("Content-Type", "application/json")
+	if c.Owner.Tipe != "publik" {
+		w.Header().Set("Cache-Control", "private, no-store")
+	}
+	json.NewEncoder(w).Encode(CommentListResponse{
+		Data:       comments,
+		Page:       page,
+		Limit:      limit,
+		TotalItems: totalItems,
+		TotalPages: totalPages,
+	})
+}
+
+// POST /laporan/{id}/comments - Start a thread or reply to one
+func createCommentHandler(w http.ResponseWriter, r *http.Request, laporanID int) {
+	c := loadCommentContext(w, r, laporanID, "CREATE COMMENT")
+	if c == nil {
+		return
+	}
+	if c.AuthorType == "" {
+		// An officer token for another divisi
+		writeError(w, http.StatusForbidden, ErrCodeCommentNotAllowed, "Only officers of this divisi can comment on this laporan")
+		return
+	}
+	if c.Status == statusWithdrawn {
+		writeError(w, http.StatusConflict, ErrCodeCommentThreadClosed, "Comments are closed on withdrawn laporan")
+		return
+	}
+
+	var req CreateCommentRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		log.Println("[CREATE COMMENT ERROR] Invalid request body:", err)
+		writeError(w, http.StatusBadRequest, ErrCodeInvalidRequestBody, "Invalid request body")
+		return
+	}
+	body := strings.TrimSpace(req.Body)
+	if body == "" || utf8.RuneCountInString(body) > maxCommentLength {
+		writeFieldError(w, http.StatusBadRequest, ErrCodeValidationFailed, "Comment body is empty or too long",
+			map[string]string{"body": fmt.Sprintf("must be 1 to %d characters", maxCommentLength)})
+		return
+	}
+
+	// Replies join the parent's thread: same visibility, attached to the top-level comment
+	var parentID *int
+	visibility := req.Visibility
+	if req.ParentID != nil {
+		var rootID sql.NullInt64
+		var id int
+		var parentVisibility string
+		err := db.QueryRow(`SELECT id, parent_id, visibility FROM laporan_comments WHERE id = $1 AND laporan_id = $2`,
+			*req.ParentID, laporanID).Scan(&id, &rootID, &parentVisibility)
+		if err != nil {
+			if !errors.Is(err, sql.ErrNoRows) {
+				log.Println("[CREATE COMMENT ERROR] Parent lookup error:", err)
+				writeError(w, http.StatusInternalServerError, ErrCodeInternal, "Failed to create comment")
+				return
+			}
+			writeError(w, http.StatusNotFound, ErrCodeCommentNotFound, "Parent comment not found")
+			return
+		}
+		if visibility != "" && visibility != parentVisibility {
+			writeFieldError(w, http.StatusBadRequest, ErrCodeValidationFailed, "Replies must have the same visibility as their thread",
+				map[string]string{"visibility": "must be " + parentVisibility + " for this thread"})
+			return
+		}
+		visibility = parentVisibility
+		if rootID.Valid {
+			id = int(rootID.Int64)
+		}
+		parentID = &id
+	}
+	if visibility == "" {
+		visibility = commentPrivate
+		if c.Owner.Tipe == "publik" {
+			visibility = commentPublic
+		}
+	}
+
+	allowed := false
+	for _, v := range c.visibilities() {
+		allowed = allowed || v == visibility
+	}
+	if !allowed {
+		if visibility != commentPublic && visibility != commentPrivate {
+			writeFieldError(w, http.StatusBadRequest, ErrCodeValidationFailed, "visibility must be one of: public, private", map[string]string{"visibility": "must be one of: public, private"})
+			return
+		}
+		writeError(w, http.StatusForbidden, ErrCodeCommentNotAllowed, "You cannot post "+visibility+" comments on this laporan")
+		return
+	}
+
+	row := db.QueryRow(`
+		INSERT INTO laporan_comments (laporan_id, parent_id, visibility, author_type, author_id, author_display, body)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		RETURNING `+commentColumns,
+		laporanID, parentID, visibility, c.AuthorType, c.AuthorID, c.AuthorName, body)
+	cm, err := scanComment(row.Scan, c)
+	if err != nil {
+		log.Println("[CREATE COMMENT ERROR] Database error:", err)
+		writeError(w, http.StatusInternalServerError, ErrCodeInternal, "Failed to create comment")
+		return
+	}
+
+	logRequestf(r, "[CREATE COMMENT SUCCESS] Comment %d (%s, %s) on laporan %d\n", cm.ID, visibility, c.AuthorType, laporanID)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(cm)
+}
+
+// loadVisibleComment looks up a comment the caller can read.
+// It writes a 404 and returns false otherwise.
+func loadVisibleComment(w http.ResponseWriter, c *commentContext, commentID int, tag string) (Comment, bool) {
+	row := db.QueryRow(`
+		SELECT `+commentColumns+` FROM laporan_comments
+		WHERE id = $1 AND laporan_id = $2 AND visibility = ANY($3)
+	`, commentID, c.Owner.ID, pq.Array(c.visibilities()))
+	cm, err := scanComment(row.Scan, c)
+	if err != nil {
+		if !errors.Is(err, sql.ErrNoRows) {
+			log.Printf("[%s ERROR] Database error: %v\n", tag, err)
+			writeError(w, http.StatusInternalServerError, ErrCodeInternal, "Failed to load comment")
+			return cm, false
+		}
+		writeError(w, http.StatusNotFound, ErrCodeCommentNotFound, "Comment not found")
+		return cm, false
+	}
+	return cm, true
+}
+
+// PATCH /laporan/{id}/comments/{commentId} - Author edits inside the edit window,
+// officers of the divisi moderate
+func updateCommentHandler(w http.ResponseWriter, r *http.Request, laporanID, commentID int) {
+	c := loadCommentContext(w, r, laporanID, "UPDATE COMMENT")
+	if c == nil {
+		return
+	}
+	existing, ok := loadVisibleComment(w, c, commentID, "UPDATE COMMENT")
+	if !ok {
+		return
+	}
+
+	var req UpdateCommentRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		log.Println("[UPDATE COMMENT ERROR] Invalid request body:", err)
+		writeError(w, http.StatusBadRequest, ErrCodeInvalidRequestBody, "Invalid request body")
+		return
+	}
+	if req.Body == nil && req.ModerationStatus == nil {
+		writeFieldError(w, http.StatusBadRequest, ErrCodeValidationFailed, "Nothing to update", map[string]string{"body": "at least one of body, moderation_status is required"})
+		return
+	}
+
+	var body *string
+	if req.Body != nil {
+		if !existing.IsMine {
+			writeError(w, http.StatusForbidden, ErrCodeCommentNotAllowed, "Only the author can edit a comment")
+			return
+		}
+		if !existing.Editable {
+			writeError(w, http.StatusConflict, ErrCodeCommentEditWindowClosed, fmt.Sprintf("Comments can only be edited within %s of posting", commentEditWindow))
+			return
+		}
+		trimmed := strings.TrimSpace(*req.Body)
+		if trimmed == "" || utf8.RuneCountInString(trimmed) > maxCommentLength {
+			writeFieldError(w, http.StatusBadRequest, ErrCodeValidationFailed, "Comment body is empty or too long",
+				map[string]string{"body": fmt.Sprintf("must be 1 to %d characters", maxCommentLength)})
+			return
+		}
+		body = &trimmed
+	}
+	if req.ModerationStatus != nil {
+		if !c.IsOfficer {
+			writeError(w, http.StatusForbidden, ErrCodeCommentNotAllowed, "Only officers of this divisi can moderate comments")
+			return
+		}
+		if *req.ModerationStatus != moderationVisible && *req.ModerationStatus != moderationHidden {
+			writeFieldError(w, http.StatusBadRequest, ErrCodeValidationFailed, "moderation_status must be one of: visible, hidden", map[string]string{"moderation_status": "must be one of: visible, hidden"})
+			return
+		}
+	}
+
+	// The edit window is re-checked in SQL so a request that raced past it still fails
+	row := db.QueryRow(`
+		UPDATE laporan_comments
+		SET body = COALESCE($3, body),
+		    edited_at = CASE WHEN $3::text IS NULL THEN edited_at ELSE CURRENT_TIMESTAMP END,
+		    moderation_status = COALESCE($4, moderation_status)
+		WHERE id = $1 AND laporan_id = $2
+		  AND ($3::text IS NULL OR created_at > CURRENT_TIMESTAMP - $5::double precision * INTERVAL '1 second')
+		RETURNING `+commentColumns,
+		commentID, laporanID, body, req.ModerationStatus, commentEditWindow.Seconds())
+	cm, err := scanComment(row.Scan, c)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			writeError(w, http.StatusConflict, ErrCodeCommentEditWindowClosed, fmt.Sprintf("Comments can only be edited within %s of posting", commentEditWindow))
+			return
+		}
+		log.Println("[UPDATE COMMENT ERROR] Database error:", err)
+		writeError(w, http.StatusInternalServerError, ErrCodeInternal, "Failed to update comment")
+		return
+	}
+
+	logRequestf(r, "[UPDATE COMMENT SUCCESS] Comment %d on laporan %d updated by %s\n", commentID, laporanID, c.AuthorType)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(cm)
+}
+
+// FlagCommentRequest is the POST /laporan/{id}/comments/{commentId}/flags body
+type FlagCommentRequest struct {
+	Reason string `json:"reason"`
+}
+
+// POST /laporan/{id}/comments/{commentId}/flags - Report a comment for moderation.
+// Each warga (or anonim credential) counts once; at COMMENT_FLAG_THRESHOLD flags the
+// comment is withheld until an officer reviews it.
+func flagCommentHandler(w http.ResponseWriter, r *http.Request, laporanID, commentID int) {
+	c := loadCommentContext(w, r, laporanID, "FLAG COMMENT")
+	if c == nil {
+		return
+	}
+	if c.AuthorType == "" || c.IsOfficer {
+		// Officers moderate directly with PATCH
+		writeError(w, http.StatusForbidden, ErrCodeCommentNotAllowed, "Only warga can flag comments")
+		return
+	}
+	existing, ok := loadVisibleComment(w, c, commentID, "FLAG COMMENT")
+	if !ok {
+		return
+	}
+
+	var req FlagCommentRequest
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeError(w, http.StatusBadRequest, ErrCodeInvalidRequestBody, "Invalid request body")
+			return
+		}
+	}
+	reason := strings.TrimSpace(req.Reason)
+	if utf8.RuneCountInString(reason) > maxFlagReasonLength {
+		writeFieldError(w, http.StatusBadRequest, ErrCodeValidationFailed, "Reason is too long",
+			map[string]string{"reason": fmt.Sprintf("must be at most %d characters", maxFlagReasonLength)})
+		return
+	}
+	if existing.IsMine {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		log.Println("[FLAG COMMENT ERROR] Begin transaction:", err)
+		writeError(w, http.StatusInternalServerError, ErrCodeInternal, "Failed to flag comment")
+		return
+	}
+	defer tx.Rollback()
+
+	result, err := tx.Exec(`
+		INSERT INTO laporan_comment_flags (comment_id, flagger_id, reason)
+		VALUES ($1, $2, NULLIF($3, ''))
+		ON CONFLICT (comment_id, flagger_id) DO NOTHING
+	`, commentID, c.AuthorID, reason)
+	if err == nil {
+		if n, _ := result.RowsAffected(); n > 0 {
+			// Only the flag that reaches the threshold hides the comment, so a comment
+			// an officer has restored is not hidden again by later flags
+			_, err = tx.Exec(`
+				UPDATE laporan_comments
+				SET flag_count = flag_count + 1,
+				    moderation_status = CASE
+				        WHEN moderation_status = $2 AND flag_count + 1 = $3 THEN $4
+				        ELSE moderation_status END
+				WHERE id = $1
+			`, commentID, moderationVisible, commentFlagThreshold, moderationFlagged)
+		}
+	}
+	if err == nil {
+		err = tx.Commit()
+	}
+	if err != nil {
+		log.Println("[FLAG COMMENT ERROR] Database error:", err)
+		writeError(w, http.StatusInternalServerError, ErrCodeInternal, "Failed to flag comment")
+		return
+	}
+
+	logRequestf(r, "[FLAG COMMENT] Comment %d on laporan %d flagged\n", commentID, laporanID)
+	w.WriteHeader(http.StatusNoContent)
+}
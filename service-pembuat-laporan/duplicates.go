@@ -0,0 +1,199 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// What createLaporanHandler does when a new report looks like an existing one
+const (
+	duplicateModeAllow = "allow" // create it and return the candidates alongside
+	duplicateModeWarn  = "warn"  // 409 unless the client resends with ignoreDuplicates
+	duplicateModeBlock = "block" // always 409; the reporter should support the existing one
+)
+
+const maxDuplicateCandidates = 5
+
+// Set from DUPLICATE_CHECK_MODE, DUPLICATE_MIN_SIMILARITY, DUPLICATE_RADIUS_M and DUPLICATE_WINDOW
+var duplicateCheckMode string
+var duplicateMinSimilarity float64
+var duplicateRadiusM float64
+var duplicateWindow time.Duration
+
+func initDuplicates() error {
+	duplicateCheckMode = getEnv("DUPLICATE_CHECK_MODE", duplicateModeWarn)
+	switch duplicateCheckMode {
+	case duplicateModeAllow, duplicateModeWarn, duplicateModeBlock:
+	default:
+		return fmt.Errorf("invalid DUPLICATE_CHECK_MODE")
+	}
+	var err error
+	duplicateMinSimilarity, err = strconv.ParseFloat(getEnv("DUPLICATE_MIN_SIMILARITY", "0.35"), 64)
+	if err != nil || duplicateMinSimilarity <= 0 || duplicateMinSimilarity > 1 {
+		return fmt.Errorf("invalid DUPLICATE_MIN_SIMILARITY")
+	}
+	duplicateRadiusM, err = strconv.ParseFloat(getEnv("DUPLICATE_RADIUS_M", "500"), 64)
+	if err != nil || duplicateRadiusM <= 0 || duplicateRadiusM > maxNearRadiusM {
+		return fmt.Errorf("invalid DUPLICATE_RADIUS_M")
+	}
+	duplicateWindow, err = parseDuration(getEnv("DUPLICATE_WINDOW", "30d"))
+	if err != nil || duplicateWindow <= 0 {
+		return fmt.Errorf("invalid DUPLICATE_WINDOW")
+	}
+	return nil
+}
+
+// DuplicateCandidate is an open report that looks like the one being submitted.
+// Only publik reports and the caller's own reports are ever suggested.
+type DuplicateCandidate struct {
+	ID           int     `json:"id"`
+	Title        string  `json:"title"`
+	Divisi       string  `json:"divisi"`
+	Status       string  `json:"status"`
+	SupportCount int     `json:"support_count"`
+	Similarity   float64 `json:"similarity"` // pg_trgm similarity of title and description, 0..1
+	// Meters between the two locations; omitted unless both reports have one
+	DistanceM *float64  `json:"distance_m,omitempty"`
+	IsMine    bool      `json:"is_mine,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// DuplicateCheckRequest is the body of POST /laporan/duplicates
+type DuplicateCheckRequest struct {
+	Title       string   `json:"title"`
+	Description string   `json:"description"`
+	Divisi      string   `json:"divisi"`
+	Latitude    *float64 `json:"latitude,omitempty"`
+	Longitude   *float64 `json:"longitude,omitempty"`
+}
+
+type DuplicateCheckResponse struct {
+	Mode       string               `json:"mode"`
+	Candidates []DuplicateCandidate `json:"candidates"`
+}
+
+// DuplicateErrorResponse is the DUPLICATE_SUSPECTED error envelope, with the candidates
+// the client can offer to support instead. Mode tells it whether resending is allowed.
+type DuplicateErrorResponse struct {
+	Error      APIError             `json:"error"`
+	Mode       string               `json:"mode"`
+	Candidates []DuplicateCandidate `json:"candidates"`
+}
+
+// findDuplicates looks for open reports in the same divisi created within the
+// duplicate window whose text is similar enough. When the new report has a location,
+// located candidates must also lie within the duplicate radius. Reports already
+// linked to a parent are skipped so suggestions always point at the parent.
+func findDuplicates(title, description, divisi string, location *Location, callerNIK string) ([]DuplicateCandidate, error) {
+	args := []interface{}{}
+	arg := func(v interface{}) string {
+		args = append(args, v)
+		return "$" + strconv.Itoa(len(args))
+	}
+
+	text := arg(title + " " + description)
+	distance := "NULL::double precision"
+	near := ""
+	if location != nil {
+		g := &geoFilter{Near: true, Lat: location.Latitude, Lng: location.Longitude}
+		distance = g.distance(arg)
+		near = " AND (latitude IS NULL OR " + distance + " <= " + arg(duplicateRadiusM) + ")"
+	}
+	nik := arg(callerNIK)
+
+	// The divisi and created_at conditions bound the scan, so similarity() is only
+	// computed for recent reports of one divisi
+	query := `
+		SELECT id, title, divisi, status, support_count, score, distance_m, is_mine, created_at
+		FROM (
+			SELECT id, title, divisi, status, support_count, created_at,
+			       similarity(title || ' ' || description, ` + text + `) AS score,
+			       CASE WHEN latitude IS NOT NULL THEN ` + distance + ` END AS distance_m,
+			       (tipe <> 'anonim' AND user_nik = ` + nik + `) AS is_mine
+			FROM laporan
+			WHERE divisi = ` + arg(divisi) + `
+			  AND status IN ('pending', 'verified', 'diproses')
+			  AND duplicate_of IS NULL
+			  AND created_at >= ` + arg(time.Now().Add(-duplicateWindow)) + `
+			  AND (tipe = 'publik' OR (tipe <> 'anonim' AND user_nik = ` + nik + `))` + near + `
+		) c
+		WHERE score >= ` + arg(duplicateMinSimilarity) + `
+		ORDER BY score DESC, created_at DESC
+		LIMIT ` + strconv.Itoa(maxDuplicateCandidates)
+
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	candidates := []DuplicateCandidate{}
+	for rows.Next() {
+		var c DuplicateCandidate
+		if err := rows.Scan(&c.ID, &c.Title, &c.Divisi, &c.Status, &c.SupportCount, &c.Similarity,
+			&c.DistanceM, &c.IsMine, &c.CreatedAt); err != nil {
+			return nil, err
+		}
+		candidates = append(candidates, c)
+	}
+	return candidates, rows.Err()
+}
+
+// writeDuplicateSuspected sends 409 DUPLICATE_SUSPECTED with the matching reports
+func writeDuplicateSuspected(w http.ResponseWriter, candidates []DuplicateCandidate) {
+	message := "Laporan serupa sudah ada; dukung laporan tersebut atau kirim ulang dengan ignoreDuplicates"
+	if duplicateCheckMode == duplicateModeBlock {
+		message = "Laporan serupa sudah ada; dukung laporan tersebut"
+	}
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(http.StatusConflict)
+	json.NewEncoder(w).Encode(DuplicateErrorResponse{
+		Error:      APIError{Code: ErrCodeDuplicateSuspected, Message: message},
+		Mode:       duplicateCheckMode,
+		Candidates: candidates,
+	})
+}
+
+// POST /laporan/duplicates - Check a draft for likely duplicates before submitting it.
+// Runs the same search as POST /laporan and never writes anything.
+func checkDuplicatesHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeMethodNotAllowed(w)
+		return
+	}
+
+	var req DuplicateCheckRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, ErrCodeInvalidRequestBody, "Invalid request body")
+		return
+	}
+	if req.Title == "" && req.Description == "" {
+		writeFieldError(w, http.StatusBadRequest, ErrCodeValidationFailed, "Title or description is required",
+			map[string]string{"title": "required", "description": "required"})
+		return
+	}
+	if !validDivisi[req.Divisi] {
+		writeFieldError(w, http.StatusBadRequest, ErrCodeDivisiInvalid, "Divisi must be one of: kebersihan, kesehatan, fasilitas umum, kriminalitas", map[string]string{"divisi": "must be one of: kebersihan, kesehatan, fasilitas umum, kriminalitas"})
+		return
+	}
+	location, fields := validateLocation(req.Latitude, req.Longitude, nil)
+	if len(fields) > 0 {
+		writeFieldError(w, http.StatusBadRequest, ErrCodeValidationFailed, "Invalid location", fields)
+		return
+	}
+
+	candidates, err := findDuplicates(req.Title, req.Description, req.Divisi, location, r.Header.Get("X-User-NIK"))
+	if err != nil {
+		log.Println("[CHECK DUPLICATES ERROR] Database error:", err)
+		writeError(w, http.StatusInternalServerError, ErrCodeInternal, "Failed to check duplicates")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(DuplicateCheckResponse{Mode: duplicateCheckMode, Candidates: candidates})
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+)
+
+// Error codes returned in the "code" field of every error response.
+// The full catalog with HTTP statuses lives in ERROR-CODES.md at the repo root;
+// keep both in sync when adding a code.
+const (
+	ErrCodeMethodNotAllowed         = "METHOD_NOT_ALLOWED"
+	ErrCodeInvalidRequestBody       = "INVALID_REQUEST_BODY"
+	ErrCodeValidationFailed         = "VALIDATION_FAILED"
+	ErrCodeTokenMissing             = "TOKEN_MISSING"
+	ErrCodeTokenExpired             = "TOKEN_EXPIRED"
+	ErrCodeTokenInvalid             = "TOKEN_INVALID"
+	ErrCodeForbiddenRole            = "FORBIDDEN_ROLE"
+	ErrCodeUserNotFound             = "USER_NOT_FOUND"
+	ErrCodeTipeInvalid              = "TIPE_INVALID"
+	ErrCodeDivisiInvalid            = "DIVISI_INVALID"
+	ErrCodeAnonCredentialRequired   = "ANON_CREDENTIAL_REQUIRED"
+	ErrCodeStatusInvalid            = "STATUS_INVALID"
+	ErrCodeNotFound                 = "NOT_FOUND"
+	ErrCodeLaporanNotFound          = "LAPORAN_NOT_FOUND"
+	ErrCodeTooManyAttachments       = "TOO_MANY_ATTACHMENTS"
+	ErrCodeAttachmentTooLarge       = "ATTACHMENT_TOO_LARGE"
+	ErrCodeAttachmentTypeNotAllowed = "ATTACHMENT_TYPE_NOT_ALLOWED"
+	ErrCodeAttachmentNotFound       = "ATTACHMENT_NOT_FOUND"
+	ErrCodeAttachmentInvalidImage   = "ATTACHMENT_INVALID_IMAGE"
+	ErrCodeCursorInvalid            = "CURSOR_INVALID"
+	ErrCodeLaporanNotEditable       = "LAPORAN_NOT_EDITABLE"
+	ErrCodeVersionConflict          = "VERSION_CONFLICT"
+	ErrCodeCommentNotFound          = "COMMENT_NOT_FOUND"
+	ErrCodeCommentNotAllowed        = "COMMENT_NOT_ALLOWED"
+	ErrCodeCommentThreadClosed      = "COMMENT_THREAD_CLOSED"
+	ErrCodeCommentEditWindowClosed  = "COMMENT_EDIT_WINDOW_CLOSED"
+	ErrCodeCannotSupportOwnLaporan  = "CANNOT_SUPPORT_OWN_LAPORAN"
+	ErrCodeDuplicateSuspected       = "DUPLICATE_SUSPECTED"
+	ErrCodeLiveFeedFull             = "LIVE_FEED_FULL"
+	ErrCodePushDisabled             = "PUSH_DISABLED"
+	ErrCodeTrackingCodeRequired     = "TRACKING_CODE_REQUIRED"
+	ErrCodeAnonTokensDisabled       = "ANON_TOKENS_DISABLED"
+	ErrCodeAnonTokenRequired        = "ANON_TOKEN_REQUIRED"
+	ErrCodeAnonTokenInvalid         = "ANON_TOKEN_INVALID"
+	ErrCodeAnonTokenSpent           = "ANON_TOKEN_SPENT"
+	ErrCodeAnonPathRequired         = "ANON_PATH_REQUIRED"
+	ErrCodeAnonPathAnonimOnly       = "ANON_PATH_ANONIM_ONLY"
+	ErrCodeIdempotencyKeyInvalid    = "IDEMPOTENCY_KEY_INVALID"
+	ErrCodeIdempotencyKeyReused     = "IDEMPOTENCY_KEY_REUSED"
+	ErrCodeIdempotencyKeyInProgress = "IDEMPOTENCY_KEY_IN_PROGRESS"
+	ErrCodeRateLimited              = "RATE_LIMITED"
+	ErrCodeInternal                 = "INTERNAL_ERROR"
+)
+
+// APIError is the machine-readable error object sent to clients.
+// Fields maps request field names to a human-readable reason and is omitted when empty.
+type APIError struct {
+	Code    string            `json:"code"`
+	Message string            `json:"message"`
+	Fields  map[string]string `json:"fields,omitempty"`
+}
+
+// ErrorResponse wraps APIError so every error body has the shape {"error":{...}}
+type ErrorResponse struct {
+	Error APIError `json:"error"`
+}
+
+// writeError sends a JSON error envelope with the given HTTP status
+func writeError(w http.ResponseWriter, status int, code, message string) {
+	writeFieldError(w, status, code, message, nil)
+}
+
+// writeFieldError sends a JSON error envelope including per-field validation reasons
+func writeFieldError(w http.ResponseWriter, status int, code, message string, fields map[string]string) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(ErrorResponse{
+		Error: APIError{Code: code, Message: message, Fields: fields},
+	})
+}
+
+// writeMethodNotAllowed is shared by every handler that only accepts one method
+func writeMethodNotAllowed(w http.ResponseWriter) {
+	writeError(w, http.StatusMethodNotAllowed, ErrCodeMethodNotAllowed, "Method not allowed")
+}
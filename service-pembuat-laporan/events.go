@@ -0,0 +1,250 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// Events are written to laporan_events by database triggers and announced with
+// NOTIFY on this channel, so a status change made by service-penerima-laporan
+// reaches streams on every replica of this service
+const eventsChannel = "laporan_events"
+
+const (
+	maxEventsPerBatch = 100
+	sseRetryMillis    = 5000
+)
+
+// Set from SSE_HEARTBEAT and SSE_EVENT_RETENTION
+var sseHeartbeat time.Duration
+var sseEventRetention time.Duration
+
+// eventHub wakes the open streams of this replica, keyed by the owner's NIK.
+// Streams load the events themselves, so a wake-up never carries data and a
+// missed one is caught up on the next.
+type eventHub struct {
+	mu   sync.Mutex
+	subs map[string]map[chan struct{}]bool
+}
+
+var events = &eventHub{subs: map[string]map[chan struct{}]bool{}}
+
+func (h *eventHub) subscribe(nik string) chan struct{} {
+	ch := make(chan struct{}, 1)
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.subs[nik] == nil {
+		h.subs[nik] = map[chan struct{}]bool{}
+	}
+	h.subs[nik][ch] = true
+	return ch
+}
+
+func (h *eventHub) unsubscribe(nik string, ch chan struct{}) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	delete(h.subs[nik], ch)
+	if len(h.subs[nik]) == 0 {
+		delete(h.subs, nik)
+	}
+}
+
+// wake signals every stream of nik, or every stream when nik is empty
+func (h *eventHub) wake(nik string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for key, chans := range h.subs {
+		if nik != "" && key != nik {
+			continue
+		}
+		for ch := range chans {
+			select {
+			case ch <- struct{}{}:
+			default: // already pending
+			}
+		}
+	}
+}
+
+// dispatchNotifications forwards notifications until the listener is closed. pq sends
+// a nil notification after reconnecting, when anything may have been missed.
+func dispatchNotifications(l *pq.Listener) {
+	for {
+		select {
+		case n, ok := <-l.Notify:
+			if !ok {
+				return
+			}
+			if n == nil {
+				events.wake("")
+				continue
+			}
+			var payload struct {
+				ID    int    `json:"id"`
+				NIK   string `json:"nik"`
+				Event string `json:"event"`
+			}
+			if err := json.Unmarshal([]byte(n.Extra), &payload); err != nil {
+				log.Println("[EVENTS ERROR] Invalid notification:", err)
+				continue
+			}
+			switch n.Channel {
+			case eventsChannel:
+				events.wake(payload.NIK)
+				wakePush()
+			case publicFeedChannel:
+				liveFeed.publish(payload.Event, payload.ID)
+			}
+		case <-time.After(90 * time.Second):
+			go l.Ping()
+		}
+	}
+}
+
+func initEvents(connStr string) error {
+	var err error
+	sseHeartbeat, err = parseDuration(getEnv("SSE_HEARTBEAT", "15s"))
+	if err != nil || sseHeartbeat <= 0 {
+		return fmt.Errorf("invalid SSE_HEARTBEAT")
+	}
+	sseEventRetention, err = parseDuration(getEnv("SSE_EVENT_RETENTION", "1d"))
+	if err != nil || sseEventRetention <= 0 {
+		return fmt.Errorf("invalid SSE_EVENT_RETENTION")
+	}
+
+	listener := pq.NewListener(connStr, time.Second, time.Minute, func(ev pq.ListenerEventType, err error) {
+		if err != nil {
+			log.Println("[EVENTS ERROR] Listener:", err)
+		}
+	})
+	for _, channel := range []string{eventsChannel, publicFeedChannel} {
+		if err := listener.Listen(channel); err != nil {
+			return err
+		}
+	}
+	go dispatchNotifications(listener)
+	go pruneEvents()
+	return nil
+}
+
+// pruneEvents drops events older than SSE_EVENT_RETENTION; a stream resuming from
+// an older Last-Event-ID only receives what is left
+func pruneEvents() {
+	for {
+		result, err := db.Exec(`DELETE FROM laporan_events WHERE created_at < $1`, time.Now().Add(-sseEventRetention))
+		if err != nil {
+			log.Println("[EVENTS ERROR] Prune failed:", err)
+		} else if n, _ := result.RowsAffected(); n > 0 {
+			log.Printf("[EVENTS] Pruned %d old events\n", n)
+		}
+		time.Sleep(time.Hour)
+	}
+}
+
+// GET /laporan/my/events - Server-Sent Events stream of status changes and officer
+// comments on the caller's reports. Each event's id is its laporan_events id, so a
+// client reconnecting with Last-Event-ID receives everything it missed. Anonim reports
+// are never streamed because they are not linked to the caller's NIK.
+func myLaporanEventsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeMethodNotAllowed(w)
+		return
+	}
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		writeError(w, http.StatusInternalServerError, ErrCodeInternal, "Streaming not supported")
+		return
+	}
+	userNik := r.Header.Get("X-User-NIK")
+
+	// Subscribe before reading the starting point so nothing committed in between is missed
+	wake := events.subscribe(userNik)
+	defer events.unsubscribe(userNik, wake)
+
+	lastID, err := strconv.ParseInt(r.Header.Get("Last-Event-ID"), 10, 64)
+	resume := err == nil && lastID >= 0
+	if !resume {
+		if err := db.QueryRow(`SELECT COALESCE(MAX(id), 0) FROM laporan_events`).Scan(&lastID); err != nil {
+			log.Println("[LAPORAN EVENTS ERROR] Database error:", err)
+			writeError(w, http.StatusInternalServerError, ErrCodeInternal, "Failed to open event stream")
+			return
+		}
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no") // keep nginx from buffering the stream
+	w.WriteHeader(http.StatusOK)
+	fmt.Fprintf(w, "retry: %d\n\n", sseRetryMillis)
+	flusher.Flush()
+
+	// send writes every event after lastID
+	send := func() error {
+		for {
+			rows, err := db.Query(`
+				SELECT id, event_type, data
+				FROM laporan_events
+				WHERE user_nik = $1 AND id > $2
+				ORDER BY id
+				LIMIT $3
+			`, userNik, lastID, maxEventsPerBatch)
+			if err != nil {
+				return err
+			}
+			n := 0
+			for rows.Next() {
+				var eventType, data string
+				if err := rows.Scan(&lastID, &eventType, &data); err != nil {
+					rows.Close()
+					return err
+				}
+				if _, err := fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", lastID, eventType, data); err != nil {
+					rows.Close()
+					return err
+				}
+				n++
+			}
+			rows.Close()
+			if err := rows.Err(); err != nil {
+				return err
+			}
+			flusher.Flush()
+			if n < maxEventsPerBatch {
+				return nil
+			}
+		}
+	}
+
+	if resume {
+		if err := send(); err != nil {
+			log.Println("[LAPORAN EVENTS ERROR] Send failed:", err)
+			return
+		}
+	}
+
+	heartbeat := time.NewTicker(sseHeartbeat)
+	defer heartbeat.Stop()
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-wake:
+			if err := send(); err != nil {
+				log.Println("[LAPORAN EVENTS ERROR] Send failed:", err)
+				return
+			}
+		case <-heartbeat.C:
+			if _, err := fmt.Fprint(w, ": heartbeat\n\n"); err != nil {
+				return
+			}
+			flusher.Flush()
+		}
+	}
+}
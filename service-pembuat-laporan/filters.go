@@ -0,0 +1,97 @@
+package main
+
+import (
+	"net/url"
+	"strings"
+	"time"
+)
+
+// Sort orders accepted by /laporan/public?sort=
+var publicSortOrders = map[string]string{
+	"newest":  "created_at DESC, id DESC",
+	"oldest":  "created_at ASC, id ASC",
+	"updated": "updated_at DESC, id DESC",
+	// Most "saya juga mengalami" votes first
+	"supported": "support_count DESC, created_at DESC, id DESC",
+}
+
+// parseMultiValue reads a filter given as repeated parameters and/or a
+// comma-separated list (?divisi=kebersihan&divisi=kesehatan or ?divisi=kebersihan,kesehatan)
+func parseMultiValue(query url.Values, key string) []string {
+	var values []string
+	seen := map[string]bool{}
+	for _, raw := range query[key] {
+		for _, v := range strings.Split(raw, ",") {
+			v = strings.TrimSpace(v)
+			if v != "" && !seen[v] {
+				seen[v] = true
+				values = append(values, v)
+			}
+		}
+	}
+	return values
+}
+
+// parseDivisiFilter validates every divisi value; ok is false if one is unknown
+func parseDivisiFilter(query url.Values) (values []string, ok bool) {
+	values = parseMultiValue(query, "divisi")
+	for _, v := range values {
+		if !validDivisi[v] {
+			return nil, false
+		}
+	}
+	return values, true
+}
+
+// parseStatusFilter validates every status value against the canonical statuses
+func parseStatusFilter(query url.Values) (values []string, ok bool) {
+	values = parseMultiValue(query, "status")
+	for _, v := range values {
+		if !validStatus[v] {
+			return nil, false
+		}
+	}
+	return values, true
+}
+
+// Layout of a TIMESTAMP bound passed to Postgres: wall-clock time, no offset
+const timestampBoundLayout = "2006-01-02 15:04:05.999999"
+
+// parseTimeBound reads a date (2006-01-02) or RFC 3339 timestamp. A bare date used
+// as an upper bound covers the whole day, so ?created_to=2024-05-31 includes May 31.
+// created_at and updated_at are TIMESTAMP columns holding server local time, and
+// Postgres drops the offset of a timestamptz compared with them, so the bound is
+// converted to local time and returned without an offset.
+func parseTimeBound(value string, upper bool) (string, bool) {
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t.In(time.Local).Format(timestampBoundLayout), true
+	}
+	t, err := time.ParseInLocation("2006-01-02", value, time.Local)
+	if err != nil {
+		return "", false
+	}
+	if upper {
+		t = t.AddDate(0, 0, 1).Add(-time.Microsecond)
+	}
+	return t.Format(timestampBoundLayout), true
+}
+
+// timeRangeWhere adds <column> range conditions for ?<prefix>_from= and ?<prefix>_to=
+func timeRangeWhere(query url.Values, prefix, column string, arg func(interface{}) string, fields map[string]string) string {
+	var cond string
+	if v := query.Get(prefix + "_from"); v != "" {
+		if t, ok := parseTimeBound(v, false); ok {
+			cond += " AND " + column + " >= " + arg(t)
+		} else {
+			fields[prefix+"_from"] = "must be YYYY-MM-DD or an RFC 3339 timestamp"
+		}
+	}
+	if v := query.Get(prefix + "_to"); v != "" {
+		if t, ok := parseTimeBound(v, true); ok {
+			cond += " AND " + column + " <= " + arg(t)
+		} else {
+			fields[prefix+"_to"] = "must be YYYY-MM-DD or an RFC 3339 timestamp"
+		}
+	}
+	return cond
+}
@@ -0,0 +1,35 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseTimeBoundUsesServerLocalTime(t *testing.T) {
+	saved := time.Local
+	t.Cleanup(func() { time.Local = saved })
+	time.Local = time.FixedZone("WIB", 7*3600)
+
+	cases := []struct {
+		value string
+		upper bool
+		want  string
+	}{
+		{"2024-05-31", false, "2024-05-31 00:00:00"},
+		{"2024-05-31", true, "2024-05-31 23:59:59.999999"},
+		{"2024-05-31T10:00:00+07:00", false, "2024-05-31 10:00:00"},
+		{"2024-05-31T03:00:00Z", false, "2024-05-31 10:00:00"},
+		{"2024-05-31T20:30:00-05:00", true, "2024-06-01 08:30:00"},
+	}
+	for _, tc := range cases {
+		got, ok := parseTimeBound(tc.value, tc.upper)
+		if !ok || got != tc.want {
+			t.Errorf("parseTimeBound(%q, %v) = %q, %v; want %q", tc.value, tc.upper, got, ok, tc.want)
+		}
+	}
+	for _, bad := range []string{"31-05-2024", "2024-05-31T10:00:00", "kemarin"} {
+		if _, ok := parseTimeBound(bad, false); ok {
+			t.Errorf("parseTimeBound(%q) accepted", bad)
+		}
+	}
+}
@@ -0,0 +1,242 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// Limits for /laporan/public geo queries
+const (
+	defaultNearRadiusM = 1000
+	maxNearRadiusM     = 50000
+	earthRadiusM       = 6371000
+	metersPerDegreeLat = 111320
+)
+
+// Private reports are only ever shown snapped to a grid of this many degrees (~1.1 km)
+const fuzzedLocationGridDeg = 0.01
+
+// Location is where a laporan was made. AccuracyM is the radius reported by the
+// device (or the fuzzing radius for redacted locations) and is omitted when unknown.
+type Location struct {
+	Latitude  float64  `json:"latitude"`
+	Longitude float64  `json:"longitude"`
+	AccuracyM *float64 `json:"accuracy_m,omitempty"`
+}
+
+// validateLocation checks optional coordinates from CreateLaporanRequest.
+// It returns nil when none were sent, or field errors keyed by request field.
+func validateLocation(lat, lng, accuracy *float64) (*Location, map[string]string) {
+	fields := map[string]string{}
+	if lat == nil && lng == nil {
+		if accuracy != nil {
+			fields["locationAccuracy"] = "requires latitude and longitude"
+		}
+		return nil, fields
+	}
+	if lat == nil || lng == nil {
+		fields["latitude"] = "latitude and longitude must be sent together"
+		fields["longitude"] = "latitude and longitude must be sent together"
+		return nil, fields
+	}
+	if math.IsNaN(*lat) || *lat < -90 || *lat > 90 {
+		fields["latitude"] = "must be between -90 and 90"
+	}
+	if math.IsNaN(*lng) || *lng < -180 || *lng > 180 {
+		fields["longitude"] = "must be between -180 and 180"
+	}
+	if accuracy != nil && (math.IsNaN(*accuracy) || *accuracy < 0 || *accuracy > 100000) {
+		fields["locationAccuracy"] = "must be between 0 and 100000 meters"
+	}
+	if len(fields) > 0 {
+		return nil, fields
+	}
+	return &Location{Latitude: *lat, Longitude: *lng, AccuracyM: accuracy}, fields
+}
+
+// scanLocation builds a Location from nullable columns
+func scanLocation(lat, lng, accuracy *float64) *Location {
+	if lat == nil || lng == nil {
+		return nil
+	}
+	return &Location{Latitude: *lat, Longitude: *lng, AccuracyM: accuracy}
+}
+
+// publicLocation is the only way a location may leave the service to someone other
+// than the reporter: publik as-is, private snapped to a ~1 km grid, anonim never.
+func publicLocation(tipe string, loc *Location) *Location {
+	if loc == nil {
+		return nil
+	}
+	switch tipe {
+	case "publik":
+		return loc
+	case "private":
+		accuracy := fuzzedLocationGridDeg * metersPerDegreeLat
+		if loc.AccuracyM != nil && *loc.AccuracyM > accuracy {
+			accuracy = *loc.AccuracyM
+		}
+		return &Location{
+			Latitude:  math.Round(loc.Latitude/fuzzedLocationGridDeg) * fuzzedLocationGridDeg,
+			Longitude: math.Round(loc.Longitude/fuzzedLocationGridDeg) * fuzzedLocationGridDeg,
+			AccuracyM: &accuracy,
+		}
+	default:
+		return nil
+	}
+}
+
+// geoFilter is a parsed ?near=lat,lng&radius=m or ?bbox=minLng,minLat,maxLng,maxLat
+type geoFilter struct {
+	Near    bool
+	Lat     float64
+	Lng     float64
+	RadiusM float64
+	// Bounding box; for near queries this is the box around the circle used to hit the index
+	MinLng, MinLat, MaxLng, MaxLat float64
+}
+
+// parseGeoFilter reads the geo query parameters. It returns nil when none were given.
+func parseGeoFilter(query url.Values) (*geoFilter, map[string]string) {
+	fields := map[string]string{}
+	near, bbox := query.Get("near"), query.Get("bbox")
+	if near == "" && bbox == "" {
+		if query.Get("radius") != "" {
+			fields["radius"] = "requires near"
+		}
+		return nil, fields
+	}
+	if near != "" && bbox != "" {
+		fields["bbox"] = "cannot be combined with near"
+		return nil, fields
+	}
+
+	if bbox != "" {
+		v, ok := parseFloats(bbox, 4)
+		if !ok || v[0] < -180 || v[2] > 180 || v[1] < -90 || v[3] > 90 || v[0] >= v[2] || v[1] >= v[3] {
+			fields["bbox"] = "must be minLng,minLat,maxLng,maxLat"
+			return nil, fields
+		}
+		return &geoFilter{MinLng: v[0], MinLat: v[1], MaxLng: v[2], MaxLat: v[3]}, fields
+	}
+
+	v, ok := parseFloats(near, 2)
+	if !ok || v[0] < -90 || v[0] > 90 || v[1] < -180 || v[1] > 180 {
+		fields["near"] = "must be lat,lng"
+		return nil, fields
+	}
+	f := &geoFilter{Near: true, Lat: v[0], Lng: v[1], RadiusM: defaultNearRadiusM}
+	if r := query.Get("radius"); r != "" {
+		radius, err := strconv.ParseFloat(r, 64)
+		if err != nil || radius <= 0 || radius > maxNearRadiusM {
+			fields["radius"] = fmt.Sprintf("must be between 1 and %d meters", maxNearRadiusM)
+			return nil, fields
+		}
+		f.RadiusM = radius
+	}
+
+	dLat := f.RadiusM / metersPerDegreeLat
+	dLng := 180.0
+	if c := math.Cos(f.Lat * math.Pi / 180); c > 0.01 {
+		dLng = math.Min(180, dLat/c)
+	}
+	f.MinLat, f.MaxLat = math.Max(-90, f.Lat-dLat), math.Min(90, f.Lat+dLat)
+	f.MinLng, f.MaxLng = math.Max(-180, f.Lng-dLng), math.Min(180, f.Lng+dLng)
+	return f, fields
+}
+
+func parseFloats(s string, n int) ([]float64, bool) {
+	parts := strings.Split(s, ",")
+	if len(parts) != n {
+		return nil, false
+	}
+	values := make([]float64, n)
+	for i, p := range parts {
+		v, err := strconv.ParseFloat(strings.TrimSpace(p), 64)
+		if err != nil || math.IsNaN(v) || math.IsInf(v, 0) {
+			return nil, false
+		}
+		values[i] = v
+	}
+	return values, true
+}
+
+// where returns the SQL condition for the filter. The box test matches the
+// idx_laporan_location expression index; near queries then apply the exact distance.
+func (f *geoFilter) where(arg func(interface{}) string) string {
+	cond := "latitude IS NOT NULL AND point(longitude, latitude) <@ box(point(" +
+		arg(f.MinLng) + ", " + arg(f.MinLat) + "), point(" + arg(f.MaxLng) + ", " + arg(f.MaxLat) + "))"
+	if f.Near {
+		cond += " AND " + f.distance(arg) + " <= " + arg(f.RadiusM)
+	}
+	return cond
+}
+
+// distance returns the SQL haversine distance in meters from the near point
+func (f *geoFilter) distance(arg func(interface{}) string) string {
+	lat, lng := arg(f.Lat), arg(f.Lng)
+	// least() guards asin against rounding just above 1 for antipodal points
+	return fmt.Sprintf("(%d * 2 * asin(least(1, sqrt(power(sin(radians(latitude - %s) / 2), 2) + "+
+		"cos(radians(%s)) * cos(radians(latitude)) * power(sin(radians(longitude - %s) / 2), 2)))))",
+		earthRadiusM, lat, lat, lng)
+}
+
+// contains applies the filter to a location in Go, for reports that never pass through SQL
+func (f *geoFilter) contains(loc *Location) bool {
+	if loc == nil || loc.Longitude < f.MinLng || loc.Longitude > f.MaxLng || loc.Latitude < f.MinLat || loc.Latitude > f.MaxLat {
+		return false
+	}
+	return !f.Near || haversineM(f.Lat, f.Lng, loc.Latitude, loc.Longitude) <= f.RadiusM
+}
+
+// haversineM is the great-circle distance in meters, matching distance() in SQL
+func haversineM(lat1, lng1, lat2, lng2 float64) float64 {
+	rad := math.Pi / 180
+	h := math.Pow(math.Sin((lat2-lat1)*rad/2), 2) + math.Cos(lat1*rad)*math.Cos(lat2*rad)*math.Pow(math.Sin((lng2-lng1)*rad/2), 2)
+	return earthRadiusM * 2 * math.Asin(math.Min(1, math.Sqrt(h)))
+}
+
+// GeoJSONFeatureCollection is the RFC 7946 output for map frontends,
+// with the listing's pagination fields as foreign members
+type GeoJSONFeatureCollection struct {
+	Type       string           `json:"type"`
+	Features   []GeoJSONFeature `json:"features"`
+	Page       int              `json:"page,omitempty"`
+	Limit      int              `json:"limit"`
+	TotalItems *int             `json:"totalItems,omitempty"`
+	TotalPages int              `json:"totalPages,omitempty"`
+	NextCursor *string          `json:"nextCursor,omitempty"`
+	PrevCursor *string          `json:"prevCursor,omitempty"`
+}
+
+type GeoJSONFeature struct {
+	Type       string          `json:"type"`
+	ID         int             `json:"id"`
+	Geometry   GeoJSONGeometry `json:"geometry"`
+	Properties PublicLaporan   `json:"properties"`
+}
+
+type GeoJSONGeometry struct {
+	Type        string    `json:"type"`
+	Coordinates []float64 `json:"coordinates"` // [longitude, latitude]
+}
+
+// geoJSONFeatures converts laporan with a location into Point features
+func geoJSONFeatures(list []PublicLaporan) []GeoJSONFeature {
+	features := []GeoJSONFeature{}
+	for _, l := range list {
+		if l.Location == nil {
+			continue
+		}
+		features = append(features, GeoJSONFeature{
+			Type:       "Feature",
+			ID:         l.ID,
+			Geometry:   GeoJSONGeometry{Type: "Point", Coordinates: []float64{l.Location.Longitude, l.Location.Latitude}},
+			Properties: l,
+		})
+	}
+	return features
+}
@@ -4,5 +4,8 @@ go 1.21
 
 require (
 	github.com/golang-jwt/jwt/v5 v5.3.0
+	github.com/gorilla/websocket v1.5.3
 	github.com/lib/pq v1.10.9
+	golang.org/x/crypto v0.17.0
+	golang.org/x/image v0.18.0
 )
@@ -0,0 +1,286 @@
+package main
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"time"
+)
+
+// Idempotency-Key on POST /laporan: the first successful response is stored in
+// idempotency_keys for IDEMPOTENCY_KEY_TTL, and a retry with the same key and body
+// replays it instead of creating another report. The row is claimed before the report
+// is created, so replicas racing on one key cannot both create it. Failed requests
+// release the key, so a retry runs again.
+const idempotencyKeyHeader = "Idempotency-Key"
+
+const (
+	maxIdempotencyKeyLength = 255
+	// A claim whose request has not finished by then (e.g. the pod died) can be taken over
+	idempotencyClaimTimeout = 2 * time.Minute
+	// Domain separation for the hashes derived from an anonim token
+	idempotencyAnonDomain = "laporan-warga idempotency v1"
+)
+
+// Set from IDEMPOTENCY_KEY_TTL
+var idempotencyKeyTTL time.Duration
+
+func initIdempotency() error {
+	var err error
+	idempotencyKeyTTL, err = parseDuration(getEnv("IDEMPOTENCY_KEY_TTL", "24h"))
+	if err != nil || idempotencyKeyTTL <= 0 {
+		return fmt.Errorf("invalid IDEMPOTENCY_KEY_TTL")
+	}
+	go pruneIdempotencyKeys()
+	return nil
+}
+
+func pruneIdempotencyKeys() {
+	for {
+		result, err := db.Exec(`DELETE FROM idempotency_keys WHERE expires_at < CURRENT_TIMESTAMP`)
+		if err != nil {
+			log.Println("[IDEMPOTENCY ERROR] Prune failed:", err)
+		} else if n, _ := result.RowsAffected(); n > 0 {
+			log.Printf("[IDEMPOTENCY] Pruned %d expired keys\n", n)
+		}
+		time.Sleep(time.Hour)
+	}
+}
+
+// validIdempotencyKey accepts 1 to 255 printable ASCII characters, e.g. a UUID
+func validIdempotencyKey(key string) bool {
+	if key == "" || len(key) > maxIdempotencyKeyLength {
+		return false
+	}
+	for i := 0; i < len(key); i++ {
+		if key[i] < 0x21 || key[i] > 0x7e {
+			return false
+		}
+	}
+	return true
+}
+
+// idempotencyScope names whose key this is, so one caller can never replay another's
+// response. Anonim requests are scoped by a hash of their anonim token; the same token
+// also yields the key their stored response is encrypted with, because it contains the
+// tracking code. Requests with neither identity get no scope.
+func idempotencyScope(r *http.Request) (scope string, sealKey []byte) {
+	if nik := r.Header.Get("X-User-NIK"); nik != "" {
+		return "warga:" + nik, nil
+	}
+	token := r.Header.Get(anonTokenHeader)
+	if token == "" {
+		return "", nil
+	}
+	scopeSum := sha256.Sum256([]byte(idempotencyAnonDomain + " scope " + token))
+	keySum := sha256.Sum256([]byte(idempotencyAnonDomain + " key " + token))
+	return "anonim:" + hex.EncodeToString(scopeSum[:]), keySum[:]
+}
+
+// idempotencyFingerprint hashes the request body. The multipart boundary is left out
+// because clients pick a new one for every attempt.
+func idempotencyFingerprint(r *http.Request, body []byte) string {
+	mediaType, params, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if boundary := params["boundary"]; mediaType == "multipart/form-data" && boundary != "" {
+		body = bytes.ReplaceAll(body, []byte(boundary), nil)
+	}
+	h := sha256.New()
+	h.Write([]byte(mediaType))
+	h.Write([]byte{0})
+	h.Write(body)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+func sealIdempotentResponse(key, body []byte) ([]byte, error) {
+	if key == nil {
+		return body, nil
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	return gcm.Seal(nonce, nonce, body, nil), nil
+}
+
+func openIdempotentResponse(key, stored []byte) ([]byte, error) {
+	if key == nil {
+		return stored, nil
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	if len(stored) < gcm.NonceSize() {
+		return nil, errors.New("stored response too short")
+	}
+	return gcm.Open(nil, stored[:gcm.NonceSize()], stored[gcm.NonceSize():], nil)
+}
+
+// idempotencyRecorder passes the response through and keeps a copy to store
+type idempotencyRecorder struct {
+	http.ResponseWriter
+	status int
+	body   bytes.Buffer
+}
+
+func (rec *idempotencyRecorder) WriteHeader(status int) {
+	if rec.status == 0 {
+		rec.status = status
+	}
+	rec.ResponseWriter.WriteHeader(status)
+}
+
+func (rec *idempotencyRecorder) Write(b []byte) (int, error) {
+	if rec.status == 0 {
+		rec.status = http.StatusOK
+	}
+	rec.body.Write(b)
+	return rec.ResponseWriter.Write(b)
+}
+
+// idempotentMiddleware makes a handler honour Idempotency-Key. It runs after
+// authentication, since the key is scoped to the caller.
+func idempotentMiddleware(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		key := r.Header.Get(idempotencyKeyHeader)
+		if key == "" || r.Method != http.MethodPost {
+			next(w, r)
+			return
+		}
+		if !validIdempotencyKey(key) {
+			writeFieldError(w, http.StatusBadRequest, ErrCodeIdempotencyKeyInvalid, idempotencyKeyHeader+" must be 1 to 255 printable ASCII characters",
+				map[string]string{idempotencyKeyHeader: "1 to 255 printable ASCII characters"})
+			return
+		}
+		scope, sealKey := idempotencyScope(r)
+		if scope == "" {
+			next(w, r)
+			return
+		}
+
+		body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxUploadRequestBytes()))
+		if err != nil {
+			var tooLarge *http.MaxBytesError
+			if errors.As(err, &tooLarge) {
+				writeError(w, http.StatusRequestEntityTooLarge, ErrCodeAttachmentTooLarge, "Request body is too large")
+				return
+			}
+			writeError(w, http.StatusBadRequest, ErrCodeInvalidRequestBody, "Invalid request body")
+			return
+		}
+		r.Body = io.NopCloser(bytes.NewReader(body))
+		fingerprint := idempotencyFingerprint(r, body)
+
+		// Claim the key, or take over one whose claim or stored response has expired
+		var claimed bool
+		err = db.QueryRow(`
+			INSERT INTO idempotency_keys (scope, idem_key, request_hash, expires_at)
+			VALUES ($1, $2, $3, CURRENT_TIMESTAMP + $4::double precision * INTERVAL '1 second')
+			ON CONFLICT (scope, idem_key) DO UPDATE
+			SET request_hash = EXCLUDED.request_hash, status_code = NULL, content_type = NULL,
+			    cache_control = NULL, response_body = NULL, expires_at = EXCLUDED.expires_at
+			WHERE idempotency_keys.expires_at <= CURRENT_TIMESTAMP
+			RETURNING true
+		`, scope, key, fingerprint, idempotencyClaimTimeout.Seconds()).Scan(&claimed)
+		if errors.Is(err, sql.ErrNoRows) {
+			replayIdempotentResponse(w, r, scope, key, fingerprint, sealKey)
+			return
+		}
+		if err != nil {
+			log.Println("[IDEMPOTENCY ERROR] Claim failed:", err)
+			writeError(w, http.StatusInternalServerError, ErrCodeInternal, "Failed to process request")
+			return
+		}
+
+		rec := &idempotencyRecorder{ResponseWriter: w}
+		next(rec, r)
+
+		if rec.status < 200 || rec.status > 299 {
+			if _, err := db.Exec(`DELETE FROM idempotency_keys WHERE scope = $1 AND idem_key = $2 AND request_hash = $3 AND status_code IS NULL`,
+				scope, key, fingerprint); err != nil {
+				log.Println("[IDEMPOTENCY ERROR] Release failed:", err)
+			}
+			return
+		}
+		stored, err := sealIdempotentResponse(sealKey, rec.body.Bytes())
+		if err == nil {
+			_, err = db.Exec(`
+				UPDATE idempotency_keys
+				SET status_code = $4, content_type = $5, cache_control = $6, response_body = $7,
+				    expires_at = CURRENT_TIMESTAMP + $8::double precision * INTERVAL '1 second'
+				WHERE scope = $1 AND idem_key = $2 AND request_hash = $3
+			`, scope, key, fingerprint, rec.status, rec.Header().Get("Content-Type"), rec.Header().Get("Cache-Control"),
+				stored, idempotencyKeyTTL.Seconds())
+		}
+		if err != nil {
+			// The report exists; a retry now waits for the claim to expire and runs again
+			log.Println("[IDEMPOTENCY ERROR] Store response failed:", err)
+		}
+	}
+}
+
+// replayIdempotentResponse answers a request whose key is already claimed
+func replayIdempotentResponse(w http.ResponseWriter, r *http.Request, scope, key, fingerprint string, sealKey []byte) {
+	var requestHash string
+	var status sql.NullInt64
+	var contentType, cacheControl sql.NullString
+	var stored []byte
+	err := db.QueryRow(`
+		SELECT request_hash, status_code, content_type, cache_control, response_body
+		FROM idempotency_keys WHERE scope = $1 AND idem_key = $2
+	`, scope, key).Scan(&requestHash, &status, &contentType, &cacheControl, &stored)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		log.Println("[IDEMPOTENCY ERROR] Database error:", err)
+		writeError(w, http.StatusInternalServerError, ErrCodeInternal, "Failed to process request")
+		return
+	}
+	if err == nil && requestHash != fingerprint {
+		writeError(w, http.StatusUnprocessableEntity, ErrCodeIdempotencyKeyReused, idempotencyKeyHeader+" was already used with a different request body")
+		return
+	}
+	// Still running, or released by a failure a moment ago
+	if err != nil || !status.Valid {
+		w.Header().Set("Retry-After", "1")
+		writeError(w, http.StatusConflict, ErrCodeIdempotencyKeyInProgress, "A request with this "+idempotencyKeyHeader+" is still being processed")
+		return
+	}
+
+	body, err := openIdempotentResponse(sealKey, stored)
+	if err != nil {
+		log.Println("[IDEMPOTENCY ERROR] Stored response unreadable:", err)
+		writeError(w, http.StatusInternalServerError, ErrCodeInternal, "Failed to process request")
+		return
+	}
+	logRequestf(r, "[IDEMPOTENCY] Replayed stored response for %s\n", scope)
+	if contentType.Valid && contentType.String != "" {
+		w.Header().Set("Content-Type", contentType.String)
+	}
+	if cacheControl.Valid && cacheControl.String != "" {
+		w.Header().Set("Cache-Control", cacheControl.String)
+	}
+	w.Header().Set("Idempotent-Replayed", "true")
+	w.WriteHeader(int(status.Int64))
+	w.Write(body)
+}
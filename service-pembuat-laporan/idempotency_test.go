@@ -0,0 +1,245 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// multipartReport encodes one report form with the given boundary
+func multipartReport(t *testing.T, boundary, title string) (contentType string, body []byte) {
+	t.Helper()
+	var buf bytes.Buffer
+	mw := multipart.NewWriter(&buf)
+	if err := mw.SetBoundary(boundary); err != nil {
+		t.Fatal(err)
+	}
+	for _, f := range [][2]string{{"title", title}, {"description", "Sampah tidak diangkut seminggu"}, {"tipe", "publik"}, {"divisi", "kebersihan"}} {
+		mw.WriteField(f[0], f[1])
+	}
+	mw.Close()
+	return mw.FormDataContentType(), buf.Bytes()
+}
+
+func TestIdempotencyFingerprintIgnoresBoundary(t *testing.T) {
+	fingerprint := func(contentType string, body []byte) string {
+		req := httptest.NewRequest(http.MethodPost, "/laporan", bytes.NewReader(body))
+		req.Header.Set("Content-Type", contentType)
+		return idempotencyFingerprint(req, body)
+	}
+	ctA, bodyA := multipartReport(t, "boundaryAAAAAAAAAAAA", "Sampah menumpuk di gang")
+	ctB, bodyB := multipartReport(t, "boundaryBBBBBBBBBBBB", "Sampah menumpuk di gang")
+	ctC, bodyC := multipartReport(t, "boundaryAAAAAAAAAAAA", "Sampah menumpuk di pasar")
+
+	if fingerprint(ctA, bodyA) != fingerprint(ctB, bodyB) {
+		t.Error("the same form with a new boundary has a different fingerprint")
+	}
+	if fingerprint(ctA, bodyA) == fingerprint(ctC, bodyC) {
+		t.Error("a different form has the same fingerprint")
+	}
+	jsonBody := []byte(`{"title":"Sampah menumpuk di gang"}`)
+	if fingerprint("application/json", jsonBody) == fingerprint("text/plain", jsonBody) {
+		t.Error("the media type is not part of the fingerprint")
+	}
+}
+
+func TestValidIdempotencyKey(t *testing.T) {
+	cases := []struct {
+		key  string
+		want bool
+	}{
+		{"8e0f4c1a-2b7d-4c55-9a1e-3f6b2d9c7a10", true},
+		{"retry~1!", true},
+		{strings.Repeat("k", maxIdempotencyKeyLength), true},
+		{"", false},
+		{strings.Repeat("k", maxIdempotencyKeyLength+1), false},
+		{"two words", false},
+		{"tab\tkey", false},
+		{"kunci-é", false},
+	}
+	for _, tc := range cases {
+		if got := validIdempotencyKey(tc.key); got != tc.want {
+			t.Errorf("validIdempotencyKey(%q) = %v, want %v", tc.key, got, tc.want)
+		}
+	}
+}
+
+func TestSealIdempotentResponse(t *testing.T) {
+	req := httptest.NewRequest(http.MethodPost, "/laporan", nil)
+	req.Header.Set(anonTokenHeader, "anonim-token-1")
+	_, key := idempotencyScope(req)
+	req.Header.Set(anonTokenHeader, "anonim-token-2")
+	_, otherKey := idempotencyScope(req)
+
+	body := []byte(`{"data":{"id":7,"tracking_code":"K7QM-2XPA"}}`)
+	sealed, err := sealIdempotentResponse(key, body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Contains(sealed, []byte("K7QM-2XPA")) {
+		t.Error("sealed response contains the tracking code in the clear")
+	}
+	if opened, err := openIdempotentResponse(key, sealed); err != nil || !bytes.Equal(opened, body) {
+		t.Errorf("open = %q, %v; want the original body", opened, err)
+	}
+	if _, err := openIdempotentResponse(otherKey, sealed); err == nil {
+		t.Error("another anonim token opened the stored response")
+	}
+	if plain, _ := sealIdempotentResponse(nil, body); !bytes.Equal(plain, body) {
+		t.Error("warga responses are stored as they are")
+	}
+}
+
+// countingHandler stands in for createLaporanHandler and counts the reports it creates
+type countingHandler struct {
+	calls  int
+	status int
+}
+
+func (h *countingHandler) serve(w http.ResponseWriter, r *http.Request) {
+	h.calls++
+	if err := r.ParseMultipartForm(1 << 20); err != nil {
+		writeError(w, http.StatusBadRequest, ErrCodeInvalidRequestBody, "Invalid request body")
+		return
+	}
+	if h.status != http.StatusCreated {
+		writeError(w, h.status, ErrCodeInternal, "Failed to create laporan")
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(map[string]interface{}{"data": map[string]interface{}{"id": h.calls, "title": r.FormValue("title")}})
+}
+
+// idempotentPost sends one report with the given key, identity header and boundary
+func idempotentPost(t *testing.T, handler http.HandlerFunc, key, identityHeader, identity, boundary, title string) *httptest.ResponseRecorder {
+	t.Helper()
+	contentType, body := multipartReport(t, boundary, title)
+	req := httptest.NewRequest(http.MethodPost, "/laporan", bytes.NewReader(body))
+	req.Header.Set("Content-Type", contentType)
+	req.Header.Set(idempotencyKeyHeader, key)
+	req.Header.Set(identityHeader, identity)
+	rec := httptest.NewRecorder()
+	handler(rec, req)
+	return rec
+}
+
+func errorCode(t *testing.T, rec *httptest.ResponseRecorder) string {
+	t.Helper()
+	var body ErrorResponse
+	if err := json.NewDecoder(bytes.NewReader(rec.Body.Bytes())).Decode(&body); err != nil {
+		t.Fatalf("error body: %v: %s", err, rec.Body.String())
+	}
+	return body.Error.Code
+}
+
+func TestIdempotentMiddlewareReplay(t *testing.T) {
+	openTestDB(t)
+	idempotencyKeyTTL = time.Hour
+
+	for _, id := range []struct {
+		name, header, value string
+	}{
+		{"warga", "X-User-NIK", testNIKReporter},
+		{"anonim", anonTokenHeader, "anonim-token-1"},
+	} {
+		t.Run(id.name, func(t *testing.T) {
+			next := &countingHandler{status: http.StatusCreated}
+			handler := idempotentMiddleware(next.serve)
+			key := "replay-" + id.name
+
+			first := idempotentPost(t, handler, key, id.header, id.value, "boundaryAAAAAAAAAAAA", "Sampah menumpuk di gang")
+			if first.Code != http.StatusCreated {
+				t.Fatalf("first attempt: status %d: %s", first.Code, first.Body.String())
+			}
+			// A retry builds a fresh multipart body, with a new boundary
+			retry := idempotentPost(t, handler, key, id.header, id.value, "boundaryBBBBBBBBBBBB", "Sampah menumpuk di gang")
+			if retry.Code != http.StatusCreated || retry.Body.String() != first.Body.String() {
+				t.Fatalf("retry: status %d body %s; want the first response %s", retry.Code, retry.Body.String(), first.Body.String())
+			}
+			if retry.Header().Get("Idempotent-Replayed") != "true" {
+				t.Error("retry is not marked Idempotent-Replayed")
+			}
+			if got := retry.Header().Get("Content-Type"); got != "application/json" {
+				t.Errorf("replayed Content-Type = %q", got)
+			}
+			if got := retry.Header().Get("Cache-Control"); got != "no-store" {
+				t.Errorf("replayed Cache-Control = %q", got)
+			}
+			if next.calls != 1 {
+				t.Errorf("handler ran %d times, want 1", next.calls)
+			}
+
+			// The same key from another caller is a separate request
+			other := idempotentPost(t, handler, key, id.header, id.value+"-other", "boundaryAAAAAAAAAAAA", "Sampah menumpuk di gang")
+			if other.Code != http.StatusCreated || other.Header().Get("Idempotent-Replayed") != "" || next.calls != 2 {
+				t.Errorf("another caller's request: status %d, replayed %q, handler ran %d times",
+					other.Code, other.Header().Get("Idempotent-Replayed"), next.calls)
+			}
+		})
+	}
+
+	t.Run("anonim responses are stored encrypted", func(t *testing.T) {
+		var stored []byte
+		if err := db.QueryRow(`SELECT response_body FROM idempotency_keys WHERE idem_key = 'replay-anonim' AND scope LIKE 'anonim:%' LIMIT 1`).Scan(&stored); err != nil {
+			t.Fatal(err)
+		}
+		if bytes.Contains(stored, []byte("Sampah menumpuk")) {
+			t.Errorf("stored anonim response is readable: %s", stored)
+		}
+	})
+}
+
+func TestIdempotentMiddlewareDifferentBody(t *testing.T) {
+	openTestDB(t)
+	idempotencyKeyTTL = time.Hour
+	next := &countingHandler{status: http.StatusCreated}
+	handler := idempotentMiddleware(next.serve)
+
+	first := idempotentPost(t, handler, "reused-key", "X-User-NIK", testNIKReporter, "boundaryAAAAAAAAAAAA", "Sampah menumpuk di gang")
+	if first.Code != http.StatusCreated {
+		t.Fatalf("first attempt: status %d: %s", first.Code, first.Body.String())
+	}
+	reused := idempotentPost(t, handler, "reused-key", "X-User-NIK", testNIKReporter, "boundaryAAAAAAAAAAAA", "Jalan berlubang di depan sekolah")
+	if reused.Code != http.StatusUnprocessableEntity {
+		t.Fatalf("status = %d, want 422: %s", reused.Code, reused.Body.String())
+	}
+	if code := errorCode(t, reused); code != ErrCodeIdempotencyKeyReused {
+		t.Errorf("code = %s, want %s", code, ErrCodeIdempotencyKeyReused)
+	}
+	if next.calls != 1 {
+		t.Errorf("handler ran %d times, want 1", next.calls)
+	}
+}
+
+func TestIdempotentMiddlewareReleasesFailedRequests(t *testing.T) {
+	openTestDB(t)
+	idempotencyKeyTTL = time.Hour
+	next := &countingHandler{status: http.StatusInternalServerError}
+	handler := idempotentMiddleware(next.serve)
+
+	failed := idempotentPost(t, handler, "failed-key", "X-User-NIK", testNIKReporter, "boundaryAAAAAAAAAAAA", "Sampah menumpuk di gang")
+	if failed.Code != http.StatusInternalServerError {
+		t.Fatalf("status = %d, want 500", failed.Code)
+	}
+	next.status = http.StatusCreated
+	retry := idempotentPost(t, handler, "failed-key", "X-User-NIK", testNIKReporter, "boundaryBBBBBBBBBBBB", "Sampah menumpuk di gang")
+	if retry.Code != http.StatusCreated || retry.Header().Get("Idempotent-Replayed") != "" || next.calls != 2 {
+		t.Errorf("retry after a failure: status %d, replayed %q, handler ran %d times; want it to run again",
+			retry.Code, retry.Header().Get("Idempotent-Replayed"), next.calls)
+	}
+}
+
+func TestIdempotentMiddlewareInvalidKey(t *testing.T) {
+	next := &countingHandler{status: http.StatusCreated}
+	rec := idempotentPost(t, idempotentMiddleware(next.serve), "two words", "X-User-NIK", testNIKReporter, "boundaryAAAAAAAAAAAA", "Sampah menumpuk di gang")
+	if rec.Code != http.StatusBadRequest || errorCode(t, rec) != ErrCodeIdempotencyKeyInvalid || next.calls != 0 {
+		t.Errorf("status %d, handler ran %d times: %s", rec.Code, next.calls, rec.Body.String())
+	}
+}
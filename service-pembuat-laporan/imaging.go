@@ -0,0 +1,410 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"sort"
+	"strconv"
+	"strings"
+
+	"golang.org/x/image/draw"
+	_ "golang.org/x/image/webp"
+)
+
+// Image pipeline configuration (see initImaging)
+var thumbnailSizes []int
+var maxImageDimension int
+
+// Refuse to decode anything larger than this many pixels (decompression bombs)
+const maxImagePixels = 40_000_000
+
+// JPEG quality for re-encoded photos and thumbnails
+const jpegQuality = 85
+
+// gpsLocation is a position extracted from a photo's EXIF GPS tags
+type gpsLocation struct {
+	Latitude  float64
+	Longitude float64
+}
+
+// exifData holds the few EXIF values the pipeline needs before discarding the rest
+type exifData struct {
+	Orientation int
+	GPS         *gpsLocation
+}
+
+// sanitizedImage is an upload after decoding and re-encoding. None of the original
+// metadata (EXIF, XMP, ICC, text chunks) survives because only pixels are re-encoded.
+type sanitizedImage struct {
+	Data        []byte
+	ContentType string
+	Width       int
+	Height      int
+	Thumbnails  map[int][]byte // JPEG thumbnails keyed by their longest edge in pixels
+	Location    *gpsLocation   // only set when the caller asked for GPS extraction
+}
+
+func initImaging() error {
+	sizes, err := parseThumbnailSizes(getEnv("THUMBNAIL_SIZES", "160,480"))
+	if err != nil {
+		return err
+	}
+	thumbnailSizes = sizes
+
+	maxImageDimension, err = strconv.Atoi(getEnv("IMAGE_MAX_DIMENSION", "2048"))
+	if err != nil || maxImageDimension < 64 {
+		return fmt.Errorf("invalid IMAGE_MAX_DIMENSION")
+	}
+	return nil
+}
+
+// parseThumbnailSizes reads a comma-separated list like "160,480"
+func parseThumbnailSizes(s string) ([]int, error) {
+	var sizes []int
+	for _, part := range strings.Split(s, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		size, err := strconv.Atoi(part)
+		if err != nil || size < 16 || size > 2048 {
+			return nil, fmt.Errorf("invalid THUMBNAIL_SIZES entry %q", part)
+		}
+		sizes = append(sizes, size)
+	}
+	sort.Ints(sizes)
+	return sizes, nil
+}
+
+// isSanitizableImage reports whether contentType goes through sanitizeImage
+func isSanitizableImage(contentType string) bool {
+	switch contentType {
+	case "image/jpeg", "image/png", "image/webp":
+		return true
+	}
+	return false
+}
+
+// sanitizeImage decodes an uploaded image, applies its EXIF orientation, drops all
+// metadata and re-encodes it. PNG stays PNG (screenshots, transparency); JPEG and
+// WebP become JPEG. GPS is only read when extractGPS is true, before it is discarded.
+func sanitizeImage(data []byte, contentType string, extractGPS bool) (*sanitizedImage, error) {
+	cfg, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("decode image header: %w", err)
+	}
+	if cfg.Width <= 0 || cfg.Height <= 0 || cfg.Width*cfg.Height > maxImagePixels {
+		return nil, fmt.Errorf("image dimensions %dx%d not allowed", cfg.Width, cfg.Height)
+	}
+
+	exif := readExif(data, contentType)
+
+	src, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("decode image: %w", err)
+	}
+
+	outType := "image/jpeg"
+	if contentType == "image/png" {
+		outType = "image/png"
+	}
+
+	img := orient(fitWithin(src, maxImageDimension, outType == "image/jpeg"), exif.Orientation)
+
+	out := &sanitizedImage{
+		ContentType: outType,
+		Width:       img.Bounds().Dx(),
+		Height:      img.Bounds().Dy(),
+		Thumbnails:  map[int][]byte{},
+	}
+	if out.Data, err = encodeImage(img, outType); err != nil {
+		return nil, err
+	}
+
+	for _, size := range thumbnailSizes {
+		thumb, err := encodeImage(fitWithin(img, size, true), "image/jpeg")
+		if err != nil {
+			return nil, err
+		}
+		out.Thumbnails[size] = thumb
+	}
+
+	if extractGPS {
+		out.Location = exif.GPS
+	}
+	return out, nil
+}
+
+func encodeImage(img image.Image, contentType string) ([]byte, error) {
+	var buf bytes.Buffer
+	var err error
+	if contentType == "image/png" {
+		err = png.Encode(&buf, img)
+	} else {
+		err = jpeg.Encode(&buf, img, &jpeg.Options{Quality: jpegQuality})
+	}
+	if err != nil {
+		return nil, fmt.Errorf("encode image: %w", err)
+	}
+	return buf.Bytes(), nil
+}
+
+// fitWithin copies src into a new RGBA image no larger than maxEdge on either side.
+// When flatten is true transparent areas are composited onto white (for JPEG output).
+func fitWithin(src image.Image, maxEdge int, flatten bool) *image.RGBA {
+	b := src.Bounds()
+	w, h := b.Dx(), b.Dy()
+	if w > maxEdge || h > maxEdge {
+		if w >= h {
+			h = max(1, h*maxEdge/w)
+			w = maxEdge
+		} else {
+			w = max(1, w*maxEdge/h)
+			h = maxEdge
+		}
+	}
+
+	dst := image.NewRGBA(image.Rect(0, 0, w, h))
+	op := draw.Src
+	if flatten {
+		draw.Draw(dst, dst.Bounds(), image.NewUniform(color.White), image.Point{}, draw.Src)
+		op = draw.Over
+	}
+	// Bilinear keeps resizing cheap enough for the pod's small CPU limit
+	draw.ApproxBiLinear.Scale(dst, dst.Bounds(), src, b, op, nil)
+	return dst
+}
+
+// orient applies an EXIF orientation (1-8) so the image displays upright once the
+// orientation tag itself has been stripped
+func orient(img *image.RGBA, orientation int) *image.RGBA {
+	if orientation < 2 || orientation > 8 {
+		return img
+	}
+	w, h := img.Bounds().Dx(), img.Bounds().Dy()
+	// Orientations 5-8 swap width and height
+	dw, dh := w, h
+	if orientation >= 5 {
+		dw, dh = h, w
+	}
+	dst := image.NewRGBA(image.Rect(0, 0, dw, dh))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			var dx, dy int
+			switch orientation {
+			case 2: // mirror horizontal
+				dx, dy = w-1-x, y
+			case 3: // rotate 180
+				dx, dy = w-1-x, h-1-y
+			case 4: // mirror vertical
+				dx, dy = x, h-1-y
+			case 5: // mirror horizontal + rotate 270 CW
+				dx, dy = y, x
+			case 6: // rotate 90 CW
+				dx, dy = h-1-y, x
+			case 7: // mirror horizontal + rotate 90 CW
+				dx, dy = h-1-y, w-1-x
+			case 8: // rotate 270 CW
+				dx, dy = y, w-1-x
+			}
+			si := img.PixOffset(x, y)
+			di := dst.PixOffset(dx, dy)
+			copy(dst.Pix[di:di+4], img.Pix[si:si+4])
+		}
+	}
+	return dst
+}
+
+// readExif finds the raw EXIF (TIFF) block in a JPEG, PNG or WebP file and parses it.
+// Returns an empty exifData when there is none or it is malformed.
+func readExif(data []byte, contentType string) exifData {
+	var tiff []byte
+	switch contentType {
+	case "image/jpeg":
+		tiff = jpegExifBlock(data)
+	case "image/png":
+		tiff = pngExifBlock(data)
+	case "image/webp":
+		tiff = webpExifBlock(data)
+	}
+	if tiff == nil {
+		return exifData{}
+	}
+	return parseTIFF(tiff)
+}
+
+// jpegExifBlock returns the TIFF data of the APP1 "Exif" segment
+func jpegExifBlock(data []byte) []byte {
+	if len(data) < 4 || data[0] != 0xFF || data[1] != 0xD8 {
+		return nil
+	}
+	i := 2
+	for i+4 <= len(data) {
+		if data[i] != 0xFF {
+			return nil
+		}
+		marker := data[i+1]
+		if marker == 0xFF { // fill byte
+			i++
+			continue
+		}
+		if marker == 0xDA || marker == 0xD9 { // start of scan / end of image: no more metadata
+			return nil
+		}
+		segLen := int(binary.BigEndian.Uint16(data[i+2:]))
+		if segLen < 2 || i+2+segLen > len(data) {
+			return nil
+		}
+		seg := data[i+4 : i+2+segLen]
+		if marker == 0xE1 && len(seg) > 6 && string(seg[:6]) == "Exif\x00\x00" {
+			return seg[6:]
+		}
+		i += 2 + segLen
+	}
+	return nil
+}
+
+// pngExifBlock returns the contents of the eXIf chunk
+func pngExifBlock(data []byte) []byte {
+	const sigLen = 8
+	i := sigLen
+	for i+8 <= len(data) {
+		length := int(binary.BigEndian.Uint32(data[i:]))
+		chunkType := string(data[i+4 : i+8])
+		if length < 0 || i+12+length > len(data) {
+			return nil
+		}
+		if chunkType == "eXIf" {
+			return data[i+8 : i+8+length]
+		}
+		if chunkType == "IDAT" || chunkType == "IEND" {
+			return nil
+		}
+		i += 12 + length
+	}
+	return nil
+}
+
+// webpExifBlock returns the contents of the RIFF "EXIF" chunk
+func webpExifBlock(data []byte) []byte {
+	if len(data) < 12 || string(data[:4]) != "RIFF" || string(data[8:12]) != "WEBP" {
+		return nil
+	}
+	i := 12
+	for i+8 <= len(data) {
+		chunkType := string(data[i : i+4])
+		length := int(binary.LittleEndian.Uint32(data[i+4:]))
+		if length < 0 || i+8+length > len(data) {
+			return nil
+		}
+		if chunkType == "EXIF" {
+			block := data[i+8 : i+8+length]
+			// Some encoders keep the JPEG-style prefix
+			return bytes.TrimPrefix(block, []byte("Exif\x00\x00"))
+		}
+		i += 8 + length + length%2 // chunks are padded to even length
+	}
+	return nil
+}
+
+// parseTIFF reads the orientation and GPS position from an EXIF TIFF structure
+func parseTIFF(t []byte) exifData {
+	var out exifData
+	if len(t) < 8 {
+		return out
+	}
+	var bo binary.ByteOrder
+	switch string(t[:2]) {
+	case "II":
+		bo = binary.LittleEndian
+	case "MM":
+		bo = binary.BigEndian
+	default:
+		return out
+	}
+
+	var gpsIFD uint32
+	walkIFD(t, bo, bo.Uint32(t[4:]), func(tag uint16, value []byte) {
+		switch tag {
+		case 0x0112: // Orientation (SHORT)
+			out.Orientation = int(bo.Uint16(value))
+		case 0x8825: // GPS IFD pointer (LONG)
+			gpsIFD = bo.Uint32(value)
+		}
+	})
+	if gpsIFD == 0 {
+		return out
+	}
+
+	var latRef, lngRef byte
+	var lat, lng []float64
+	walkIFD(t, bo, gpsIFD, func(tag uint16, value []byte) {
+		switch tag {
+		case 1: // GPSLatitudeRef, ASCII "N"/"S" stored inline
+			latRef = value[0]
+		case 2: // GPSLatitude, 3 RATIONALs at offset
+			lat = readRationals(t, bo, bo.Uint32(value), 3)
+		case 3: // GPSLongitudeRef, ASCII "E"/"W"
+			lngRef = value[0]
+		case 4: // GPSLongitude
+			lng = readRationals(t, bo, bo.Uint32(value), 3)
+		}
+	})
+	if len(lat) != 3 || len(lng) != 3 {
+		return out
+	}
+
+	loc := gpsLocation{
+		Latitude:  lat[0] + lat[1]/60 + lat[2]/3600,
+		Longitude: lng[0] + lng[1]/60 + lng[2]/3600,
+	}
+	if latRef == 'S' {
+		loc.Latitude = -loc.Latitude
+	}
+	if lngRef == 'W' {
+		loc.Longitude = -loc.Longitude
+	}
+	// 0,0 is what many cameras write when they had no fix
+	if loc.Latitude >= -90 && loc.Latitude <= 90 && loc.Longitude >= -180 && loc.Longitude <= 180 &&
+		(loc.Latitude != 0 || loc.Longitude != 0) {
+		out.GPS = &loc
+	}
+	return out
+}
+
+// walkIFD calls fn with the tag and the 4-byte value/offset field of each IFD entry
+func walkIFD(t []byte, bo binary.ByteOrder, offset uint32, fn func(tag uint16, value []byte)) {
+	if uint64(offset)+2 > uint64(len(t)) {
+		return
+	}
+	count := int(bo.Uint16(t[offset:]))
+	for i := 0; i < count; i++ {
+		entry := uint64(offset) + 2 + uint64(i)*12
+		if entry+12 > uint64(len(t)) {
+			return
+		}
+		fn(bo.Uint16(t[entry:]), t[entry+8:entry+12])
+	}
+}
+
+// readRationals reads n unsigned RATIONAL values (two LONGs each) at offset
+func readRationals(t []byte, bo binary.ByteOrder, offset uint32, n int) []float64 {
+	if uint64(offset)+uint64(n)*8 > uint64(len(t)) {
+		return nil
+	}
+	values := make([]float64, n)
+	for i := range values {
+		num := bo.Uint32(t[int(offset)+i*8:])
+		den := bo.Uint32(t[int(offset)+i*8+4:])
+		if den == 0 {
+			return nil
+		}
+		values[i] = float64(num) / float64(den)
+	}
+	return values
+}
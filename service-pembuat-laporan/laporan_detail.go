@@ -0,0 +1,119 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"time"
+)
+
+// LaporanDetail is a single report as returned by GET /laporan/{id}.
+// Tipe and the exact location are only included for the owner.
+type LaporanDetail struct {
+	ID           int    `json:"id"`
+	Title        string `json:"title"`
+	Description  string `json:"description"`
+	Tipe         string `json:"tipe,omitempty"`
+	Divisi       string `json:"divisi"`
+	Status       string `json:"status"`
+	Version      int    `json:"version"`
+	SupportCount int    `json:"support_count"`
+	// SupportedByMe is only ever true for an authenticated warga who supports the report
+	SupportedByMe bool `json:"supported_by_me,omitempty"`
+	// DuplicateOf is the parent report an officer linked this one to; DuplicateCount is
+	// how many reports were linked to this one
+	DuplicateOf    *int         `json:"duplicate_of,omitempty"`
+	DuplicateCount int          `json:"duplicate_count"`
+	ReporterName   string       `json:"reporter_name,omitempty"` // publik reports only
+	IsMine         bool         `json:"is_mine,omitempty"`
+	Location       *Location    `json:"location,omitempty"`
+	Attachments    []Attachment `json:"attachments"`
+	// StatusHistory is the status timeline, oldest first
+	StatusHistory []StatusChange `json:"status_history"`
+	CreatedAt     time.Time      `json:"created_at"`
+	UpdatedAt     time.Time      `json:"updated_at"`
+}
+
+// GET /laporan/{id} - One report with its attachments
+// publik: anyone; private: the owner's token; anonim: the X-Tracking-Code (or, for
+// reports never moved to a tracking code, the X-Anonim-Hash credential).
+// Anything the caller may not see is a 404, the same as a missing report.
+func getLaporanDetailHandler(w http.ResponseWriter, r *http.Request, laporanID int) {
+	var d LaporanDetail
+	var tipe string
+	var owner, trackingCodeHash sql.NullString
+	var reporterDisplay sql.NullString
+	var lat, lng, accuracy *float64
+	err := db.QueryRow(`
+		SELECT id, title, description, tipe, divisi, status, version, support_count, duplicate_of,
+		       (SELECT COUNT(*) FROM laporan c WHERE c.duplicate_of = l.id), user_nik, tracking_code_hash, reporter_display,
+		       latitude, longitude, location_accuracy_m, created_at, updated_at
+		FROM laporan l
+		WHERE id = $1
+	`, laporanID).Scan(&d.ID, &d.Title, &d.Description, &tipe, &d.Divisi, &d.Status, &d.Version, &d.SupportCount, &d.DuplicateOf, &d.DuplicateCount,
+		&owner, &trackingCodeHash, &reporterDisplay, &lat, &lng, &accuracy, &d.CreatedAt, &d.UpdatedAt)
+	if err != nil {
+		if !errors.Is(err, sql.ErrNoRows) {
+			log.Println("[GET LAPORAN DETAIL ERROR] Database error:", err)
+			writeError(w, http.StatusInternalServerError, ErrCodeInternal, "Failed to fetch laporan")
+			return
+		}
+		writeError(w, http.StatusNotFound, ErrCodeLaporanNotFound, "Laporan not found")
+		return
+	}
+
+	access := laporanOwner{ID: d.ID, Tipe: tipe, UserNik: owner.String, TrackingCodeHash: trackingCodeHash.String}
+	// A withdrawn report is gone for everyone except its owner
+	if !access.canView(r) || (d.Status == statusWithdrawn && !access.isOwner(r)) {
+		writeError(w, http.StatusNotFound, ErrCodeLaporanNotFound, "Laporan not found")
+		return
+	}
+
+	location := scanLocation(lat, lng, accuracy)
+	if access.isOwner(r) {
+		d.IsMine = true
+		d.Tipe = tipe
+		d.Location = location
+	} else {
+		d.Location = publicLocation(tipe, location)
+	}
+	if tipe == "publik" {
+		d.ReporterName = anonymousReporterName
+		if reporterDisplay.Valid {
+			d.ReporterName = reporterDisplay.String
+		}
+	}
+
+	if nik := r.Header.Get("X-User-NIK"); nik != "" && tipe == "publik" {
+		if d.SupportedByMe, err = hasSupported(d.ID, nik); err != nil {
+			log.Println("[GET LAPORAN DETAIL ERROR] Support lookup error:", err)
+			writeError(w, http.StatusInternalServerError, ErrCodeInternal, "Failed to fetch laporan")
+			return
+		}
+	}
+
+	if d.Attachments, err = loadAttachments(d.ID, tipe); err != nil {
+		log.Println("[GET LAPORAN DETAIL ERROR] Attachments error:", err)
+		writeError(w, http.StatusInternalServerError, ErrCodeInternal, "Failed to fetch laporan")
+		return
+	}
+	history, err := loadStatusHistory([]int{d.ID})
+	if err != nil {
+		log.Println("[GET LAPORAN DETAIL ERROR] Status history error:", err)
+		writeError(w, http.StatusInternalServerError, ErrCodeInternal, "Failed to fetch laporan")
+		return
+	}
+	d.StatusHistory = history[d.ID]
+	if d.StatusHistory == nil {
+		d.StatusHistory = []StatusChange{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("ETag", laporanETag(d.Version))
+	if tipe != "publik" {
+		w.Header().Set("Cache-Control", "private, no-store")
+	}
+	json.NewEncoder(w).Encode(d)
+}
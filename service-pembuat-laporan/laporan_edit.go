@@ -0,0 +1,224 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// UpdateLaporanRequest is the PATCH /laporan/{id} body; omitted fields are unchanged
+type UpdateLaporanRequest struct {
+	Title       *string `json:"title"`
+	Description *string `json:"description"`
+	Divisi      *string `json:"divisi"`
+}
+
+// laporanETag is the entity tag for a report version, used with If-Match
+func laporanETag(version int) string {
+	return fmt.Sprintf(`"%d"`, version)
+}
+
+// parseIfMatch reads an optional If-Match header; ok is false when it is malformed
+func parseIfMatch(r *http.Request) (version int, present, ok bool) {
+	header := strings.TrimSpace(r.Header.Get("If-Match"))
+	if header == "" {
+		return 0, false, true
+	}
+	v, err := strconv.Atoi(strings.Trim(strings.TrimPrefix(header, "W/"), `"`))
+	return v, true, err == nil && v > 0
+}
+
+// loadEditableLaporan applies the owner check shared by PATCH and DELETE.
+// It writes a 404 and returns nil when the caller does not own the report.
+func loadEditableLaporan(w http.ResponseWriter, r *http.Request, laporanID int, tag string) *laporanOwner {
+	owner, err := loadLaporanOwner(laporanID)
+	if err != nil || !owner.isOwner(r) {
+		if err != nil && !errors.Is(err, sql.ErrNoRows) {
+			log.Printf("[%s ERROR] Database error: %v\n", tag, err)
+		}
+		writeError(w, http.StatusNotFound, ErrCodeLaporanNotFound, "Laporan not found")
+		return nil
+	}
+	return owner
+}
+
+// writeNotEditable explains why a locked report may not be changed
+func writeNotEditable(w http.ResponseWriter, status string, version int) {
+	if status != statusPending {
+		writeError(w, http.StatusConflict, ErrCodeLaporanNotEditable, "Only pending laporan can be changed")
+		return
+	}
+	w.Header().Set("ETag", laporanETag(version))
+	writeError(w, http.StatusPreconditionFailed, ErrCodeVersionConflict, "Laporan was changed since it was fetched")
+}
+
+// saveRevision copies the current content of a report into laporan_revisions
+// before it is changed, so admins can always see what was originally submitted
+func saveRevision(tx *sql.Tx, laporanID int, changeType string) error {
+	_, err := tx.Exec(`
+		INSERT INTO laporan_revisions (laporan_id, version, title, description, divisi, status, change_type)
+		SELECT id, version, title, description, divisi, status, $2
+		FROM laporan
+		WHERE id = $1
+	`, laporanID, changeType)
+	return err
+}
+
+// PATCH /laporan/{id} - Owner edits title/description/divisi while the report is pending
+func updateLaporanHandler(w http.ResponseWriter, r *http.Request, laporanID int) {
+	owner := loadEditableLaporan(w, r, laporanID, "UPDATE LAPORAN")
+	if owner == nil {
+		return
+	}
+
+	ifMatch, hasIfMatch, ok := parseIfMatch(r)
+	if !ok {
+		writeFieldError(w, http.StatusBadRequest, ErrCodeValidationFailed, "Invalid If-Match header", map[string]string{"If-Match": "must be an ETag from GET /laporan/{id}"})
+		return
+	}
+
+	var req UpdateLaporanRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		log.Println("[UPDATE LAPORAN ERROR] Invalid request body:", err)
+		writeError(w, http.StatusBadRequest, ErrCodeInvalidRequestBody, "Invalid request body")
+		return
+	}
+
+	fields := map[string]string{}
+	if req.Title != nil && strings.TrimSpace(*req.Title) == "" {
+		fields["title"] = "must not be empty"
+	}
+	if req.Description != nil && strings.TrimSpace(*req.Description) == "" {
+		fields["description"] = "must not be empty"
+	}
+	if len(fields) > 0 {
+		writeFieldError(w, http.StatusBadRequest, ErrCodeValidationFailed, "Title and description cannot be empty", fields)
+		return
+	}
+	if req.Divisi != nil && !validDivisi[*req.Divisi] {
+		writeFieldError(w, http.StatusBadRequest, ErrCodeDivisiInvalid, "Divisi must be one of: kebersihan, kesehatan, fasilitas umum, kriminalitas", map[string]string{"divisi": "must be one of: kebersihan, kesehatan, fasilitas umum, kriminalitas"})
+		return
+	}
+	if req.Title == nil && req.Description == nil && req.Divisi == nil {
+		writeFieldError(w, http.StatusBadRequest, ErrCodeValidationFailed, "Nothing to update", map[string]string{"title": "at least one of title, description, divisi is required"})
+		return
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		log.Println("[UPDATE LAPORAN ERROR] Begin transaction:", err)
+		writeError(w, http.StatusInternalServerError, ErrCodeInternal, "Failed to update laporan")
+		return
+	}
+	defer tx.Rollback()
+
+	// Lock the row and re-check the edit rules inside the transaction
+	var status string
+	var version int
+	if err := tx.QueryRow(`SELECT status, version FROM laporan WHERE id = $1 FOR UPDATE`, laporanID).Scan(&status, &version); err != nil {
+		log.Println("[UPDATE LAPORAN ERROR] Lock error:", err)
+		writeError(w, http.StatusInternalServerError, ErrCodeInternal, "Failed to update laporan")
+		return
+	}
+	if status != statusPending || (hasIfMatch && ifMatch != version) {
+		writeNotEditable(w, status, version)
+		return
+	}
+
+	if err := saveRevision(tx, laporanID, "edit"); err != nil {
+		log.Println("[UPDATE LAPORAN ERROR] Revision error:", err)
+		writeError(w, http.StatusInternalServerError, ErrCodeInternal, "Failed to update laporan")
+		return
+	}
+
+	var l MyLaporan
+	var lat, lng, accuracy *float64
+	err = tx.QueryRow(`
+		UPDATE laporan
+		SET title = COALESCE($2, title),
+		    description = COALESCE($3, description),
+		    divisi = COALESCE($4::divisi_laporan_enum, divisi),
+		    version = version + 1,
+		    updated_at = CURRENT_TIMESTAMP
+		WHERE id = $1
+		RETURNING id, title, description, tipe, divisi, status, version, support_count, latitude, longitude, location_accuracy_m, created_at, updated_at
+	`, laporanID, req.Title, req.Description, req.Divisi).Scan(&l.ID, &l.Title, &l.Description, &l.Tipe, &l.Divisi, &l.Status,
+		&l.Version, &l.SupportCount, &lat, &lng, &accuracy, &l.CreatedAt, &l.UpdatedAt)
+	if err == nil {
+		err = tx.Commit()
+	}
+	if err != nil {
+		log.Println("[UPDATE LAPORAN ERROR] Database error:", err)
+		writeError(w, http.StatusInternalServerError, ErrCodeInternal, "Failed to update laporan")
+		return
+	}
+	l.Location = scanLocation(lat, lng, accuracy)
+
+	logRequestf(r, "[UPDATE LAPORAN SUCCESS] Laporan %d updated to version %d\n", laporanID, l.Version)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("ETag", laporanETag(l.Version))
+	json.NewEncoder(w).Encode(l)
+}
+
+// DELETE /laporan/{id} - Owner withdraws a pending report (soft delete)
+func withdrawLaporanHandler(w http.ResponseWriter, r *http.Request, laporanID int) {
+	owner := loadEditableLaporan(w, r, laporanID, "WITHDRAW LAPORAN")
+	if owner == nil {
+		return
+	}
+
+	ifMatch, hasIfMatch, ok := parseIfMatch(r)
+	if !ok {
+		writeFieldError(w, http.StatusBadRequest, ErrCodeValidationFailed, "Invalid If-Match header", map[string]string{"If-Match": "must be an ETag from GET /laporan/{id}"})
+		return
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		log.Println("[WITHDRAW LAPORAN ERROR] Begin transaction:", err)
+		writeError(w, http.StatusInternalServerError, ErrCodeInternal, "Failed to withdraw laporan")
+		return
+	}
+	defer tx.Rollback()
+
+	var status string
+	var version int
+	if err := tx.QueryRow(`SELECT status, version FROM laporan WHERE id = $1 FOR UPDATE`, laporanID).Scan(&status, &version); err != nil {
+		log.Println("[WITHDRAW LAPORAN ERROR] Lock error:", err)
+		writeError(w, http.StatusInternalServerError, ErrCodeInternal, "Failed to withdraw laporan")
+		return
+	}
+	if !canTransition(status, statusWithdrawn) || (hasIfMatch && ifMatch != version) {
+		writeNotEditable(w, status, version)
+		return
+	}
+
+	err = saveRevision(tx, laporanID, "withdraw")
+	if err == nil {
+		err = setStatusActor(tx, "warga", "")
+	}
+	if err == nil {
+		_, err = tx.Exec(`
+			UPDATE laporan
+			SET status = $2, version = version + 1, updated_at = CURRENT_TIMESTAMP
+			WHERE id = $1
+		`, laporanID, statusWithdrawn)
+	}
+	if err == nil {
+		err = tx.Commit()
+	}
+	if err != nil {
+		log.Println("[WITHDRAW LAPORAN ERROR] Database error:", err)
+		writeError(w, http.StatusInternalServerError, ErrCodeInternal, "Failed to withdraw laporan")
+		return
+	}
+
+	logRequestf(r, "[WITHDRAW LAPORAN SUCCESS] Laporan %d withdrawn by its owner\n", laporanID)
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,239 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// A trigger on laporan sends NOTIFY on this channel when a publik report is created
+// (event "created") or reaches selesai (event "resolved")
+const publicFeedChannel = "laporan_public_feed"
+
+const (
+	liveFeedSendBuffer = 32 // messages queued per client before it counts as slow
+	liveFeedWriteWait  = 10 * time.Second
+	liveFeedPongWait   = 60 * time.Second
+	liveFeedPingPeriod = 30 * time.Second
+	liveFeedReadLimit  = 512
+)
+
+// Set from LIVE_FEED_MAX_CONNECTIONS; the cap is per replica
+var liveFeedMaxConnections int
+
+var liveFeedUpgrader = websocket.Upgrader{
+	ReadBufferSize:  1024,
+	WriteBufferSize: 4096,
+	// Read-only public data, served to any origin like the rest of /laporan/public
+	CheckOrigin: func(r *http.Request) bool { return true },
+}
+
+func initLiveFeed() error {
+	var err error
+	liveFeedMaxConnections, err = strconv.Atoi(getEnv("LIVE_FEED_MAX_CONNECTIONS", "500"))
+	if err != nil || liveFeedMaxConnections < 1 {
+		return fmt.Errorf("invalid LIVE_FEED_MAX_CONNECTIONS")
+	}
+	return nil
+}
+
+// LiveFeedMessage is one WebSocket text message on /laporan/public/live
+type LiveFeedMessage struct {
+	Event   string        `json:"event"` // created or resolved
+	Laporan PublicLaporan `json:"laporan"`
+}
+
+// liveFeedClient is one subscriber and its filters. send is closed by the hub when
+// the client is removed; slow is set first if that was because it fell behind.
+type liveFeedClient struct {
+	divisi map[string]bool // empty means every divisi
+	geo    *geoFilter      // nil means everywhere
+	send   chan []byte
+	slow   bool
+}
+
+func (c *liveFeedClient) matches(l *PublicLaporan) bool {
+	if len(c.divisi) > 0 && !c.divisi[l.Divisi] {
+		return false
+	}
+	return c.geo == nil || c.geo.contains(l.Location)
+}
+
+type liveFeedHub struct {
+	mu      sync.Mutex
+	clients map[*liveFeedClient]bool
+}
+
+var liveFeed = &liveFeedHub{clients: map[*liveFeedClient]bool{}}
+
+// add registers c unless this replica is already at LIVE_FEED_MAX_CONNECTIONS
+func (h *liveFeedHub) add(c *liveFeedClient) bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if len(h.clients) >= liveFeedMaxConnections {
+		return false
+	}
+	h.clients[c] = true
+	return true
+}
+
+func (h *liveFeedHub) remove(c *liveFeedClient) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.clients[c] {
+		delete(h.clients, c)
+		close(c.send)
+	}
+}
+
+func (h *liveFeedHub) empty() bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return len(h.clients) == 0
+}
+
+// publish loads the report once and queues it for every matching client. A client
+// whose queue is full is dropped rather than allowed to hold up the others.
+func (h *liveFeedHub) publish(event string, laporanID int) {
+	if h.empty() {
+		return
+	}
+	l, err := loadLiveFeedLaporan(laporanID)
+	if err != nil {
+		if !errors.Is(err, sql.ErrNoRows) {
+			log.Println("[LIVE FEED ERROR] Database error:", err)
+		}
+		return
+	}
+	msg, err := json.Marshal(LiveFeedMessage{Event: event, Laporan: *l})
+	if err != nil {
+		log.Println("[LIVE FEED ERROR] Encode failed:", err)
+		return
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for c := range h.clients {
+		if !c.matches(l) {
+			continue
+		}
+		select {
+		case c.send <- msg:
+		default:
+			c.slow = true
+			delete(h.clients, c)
+			close(c.send)
+			log.Println("[LIVE FEED] Dropped slow client")
+		}
+	}
+}
+
+// loadLiveFeedLaporan reads a publik report with the same projection as /laporan/public
+func loadLiveFeedLaporan(id int) (*PublicLaporan, error) {
+	var l PublicLaporan
+	var lat, lng, accuracy *float64
+	err := db.QueryRow(`
+		SELECT id, title, description, divisi, COALESCE(reporter_display, $2), status, support_count,
+		       latitude, longitude, location_accuracy_m, created_at, updated_at
+		FROM laporan
+		WHERE id = $1 AND tipe = 'publik'
+	`, id, anonymousReporterName).Scan(&l.ID, &l.Title, &l.Description, &l.Divisi, &l.ReporterName, &l.Status, &l.SupportCount,
+		&lat, &lng, &accuracy, &l.CreatedAt, &l.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+	l.Location = publicLocation("publik", scanLocation(lat, lng, accuracy))
+	return &l, nil
+}
+
+// GET /laporan/public/live - WebSocket feed of publik reports as they are created or
+// resolved, for public display screens. No auth. Filters use the same parameters as
+// /laporan/public: divisi (repeatable) and the wilayah as near/radius or bbox.
+// Clients only ever receive messages; anything they send is discarded.
+func publicLiveFeedHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeMethodNotAllowed(w)
+		return
+	}
+	query := r.URL.Query()
+	divisiFilter, ok := parseDivisiFilter(query)
+	if !ok {
+		writeFieldError(w, http.StatusBadRequest, ErrCodeDivisiInvalid, "Divisi must be one of: kebersihan, kesehatan, fasilitas umum, kriminalitas", map[string]string{"divisi": "must be one of: kebersihan, kesehatan, fasilitas umum, kriminalitas"})
+		return
+	}
+	geo, fields := parseGeoFilter(query)
+	if len(fields) > 0 {
+		writeFieldError(w, http.StatusBadRequest, ErrCodeValidationFailed, "Invalid wilayah filter", fields)
+		return
+	}
+
+	c := &liveFeedClient{divisi: map[string]bool{}, geo: geo, send: make(chan []byte, liveFeedSendBuffer)}
+	for _, d := range divisiFilter {
+		c.divisi[d] = true
+	}
+	if !liveFeed.add(c) {
+		log.Println("[LIVE FEED] Connection refused: replica at capacity")
+		w.Header().Set("Retry-After", "30")
+		writeError(w, http.StatusServiceUnavailable, ErrCodeLiveFeedFull, "Too many live feed connections, try again later")
+		return
+	}
+
+	conn, err := liveFeedUpgrader.Upgrade(w, r, nil)
+	if err != nil {
+		// The upgrader has already written the error response
+		liveFeed.remove(c)
+		return
+	}
+	go writeLiveFeed(conn, c)
+
+	conn.SetReadLimit(liveFeedReadLimit)
+	conn.SetReadDeadline(time.Now().Add(liveFeedPongWait))
+	conn.SetPongHandler(func(string) error {
+		return conn.SetReadDeadline(time.Now().Add(liveFeedPongWait))
+	})
+	for {
+		if _, _, err := conn.ReadMessage(); err != nil {
+			break
+		}
+	}
+	liveFeed.remove(c)
+}
+
+// writeLiveFeed is the only writer on conn: queued messages and keepalive pings
+func writeLiveFeed(conn *websocket.Conn, c *liveFeedClient) {
+	ping := time.NewTicker(liveFeedPingPeriod)
+	defer func() {
+		ping.Stop()
+		conn.Close()
+	}()
+	for {
+		select {
+		case msg, ok := <-c.send:
+			conn.SetWriteDeadline(time.Now().Add(liveFeedWriteWait))
+			if !ok {
+				code, reason := websocket.CloseNormalClosure, ""
+				if c.slow {
+					code, reason = websocket.CloseTryAgainLater, "client too slow"
+				}
+				conn.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(code, reason))
+				return
+			}
+			if err := conn.WriteMessage(websocket.TextMessage, msg); err != nil {
+				return
+			}
+		case <-ping.C:
+			conn.SetWriteDeadline(time.Now().Add(liveFeedWriteWait))
+			if err := conn.WriteMessage(websocket.PingMessage, nil); err != nil {
+				return
+			}
+		}
+	}
+}
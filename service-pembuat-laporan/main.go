@@ -5,25 +5,36 @@ package main
 import (
 	"database/sql"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
+	"mime"
 	"net/http"
+	"net/url"
 	"os"
 	"strconv"
 	"strings"
 	"time"
+	"unicode"
+	"unicode/utf8"
 
 	"github.com/golang-jwt/jwt/v5"
-	_ "github.com/lib/pq"
+	"github.com/lib/pq"
 )
 
 type Laporan struct {
-	ID          int    `json:"id"`
-	Title       string `json:"title"`
-	Description string `json:"description"`
-	Tipe        string `json:"tipe"`
-	Divisi      string `json:"divisi"`
-	Status      string `json:"status"`
+	ID          int          `json:"id"`
+	Title       string       `json:"title"`
+	Description string       `json:"description"`
+	Tipe        string       `json:"tipe"`
+	Divisi      string       `json:"divisi"`
+	Status      string       `json:"status"`
+	Location    *Location    `json:"location,omitempty"`
+	Attachments []Attachment `json:"attachments,omitempty"`
+	// Similar open reports found when the report was created (allow and warn modes)
+	DuplicateCandidates []DuplicateCandidate `json:"duplicate_candidates,omitempty"`
+	// TrackingCode is returned once when an anonim report is created; only its hash is kept
+	TrackingCode string `json:"tracking_code,omitempty"`
 }
 
 type CreateLaporanRequest struct {
@@ -31,7 +42,20 @@ type CreateLaporanRequest struct {
 	Description string `json:"description"`
 	Tipe        string `json:"tipe"`
 	Divisi      string `json:"divisi"`
-	UserNikHash string `json:"userNikHash,omitempty"`
+	// ReporterDisplay controls how the reporter is named on publik reports: "masked" (default) or "hidden"
+	ReporterDisplay string `json:"reporterDisplay,omitempty"`
+	// LocationConsent lets GPS from publik photos be kept as structured location; ignored for other tipes
+	LocationConsent bool `json:"locationConsent,omitempty"`
+	// Optional device position; LocationAccuracy is the radius in meters
+	Latitude         *float64 `json:"latitude,omitempty"`
+	Longitude        *float64 `json:"longitude,omitempty"`
+	LocationAccuracy *float64 `json:"locationAccuracy,omitempty"`
+	// IgnoreDuplicates confirms the reporter saw the suggested duplicates (warn mode only)
+	IgnoreDuplicates bool `json:"ignoreDuplicates,omitempty"`
+	// Optional throwaway contact for email updates on an anonim report; stored with
+	// the report only, never with the account. Other tipes use the account email.
+	NotifyEmail  string `json:"notifyEmail,omitempty"`
+	NotifyLocale string `json:"notifyLocale,omitempty"`
 }
 
 type User struct {
@@ -111,11 +135,17 @@ func main() {
 	jwtAccessExpiry = getEnv("JWT_ACCESS_EXPIRY", "15m")
 	jwtRefreshExpiry = getEnv("JWT_REFRESH_EXPIRY", "7d")
 
+	// Cache for /laporan/public totals and stats ("0s" disables it)
+	var err error
+	statsCacheTTL, err = parseDuration(getEnv("STATS_CACHE_TTL", "15s"))
+	if err != nil {
+		log.Fatal("Invalid STATS_CACHE_TTL:", err)
+	}
+
 	// Connect to PostgreSQL (Laporan database)
 	connStr := fmt.Sprintf("host=%s port=%s user=%s password=%s dbname=%s sslmode=disable",
 		dbHost, dbPort, dbUser, dbPassword, dbName)
 
-	var err error
 	db, err = sql.Open("postgres", connStr)
 	if err != nil {
 		log.Fatal("Failed to connect to laporan database:", err)
@@ -142,11 +172,69 @@ func main() {
 	}
 	log.Println("Successfully connected to auth database")
 
+	// Attachment storage (local disk or S3/MinIO)
+	if err := initAttachments(); err != nil {
+		log.Fatal("Failed to initialize attachment storage:", err)
+	}
+
+	if err := initComments(); err != nil {
+		log.Fatal("Failed to initialize comments:", err)
+	}
+
+	if err := initDuplicates(); err != nil {
+		log.Fatal("Failed to initialize duplicate detection:", err)
+	}
+
+	if err := initNotifications(); err != nil {
+		log.Fatal("Failed to initialize notifications:", err)
+	}
+
+	if err := initPush(); err != nil {
+		log.Fatal("Failed to initialize Web Push:", err)
+	}
+
+	if err := initAnonTokens(); err != nil {
+		log.Fatal("Failed to initialize anonim tokens:", err)
+	}
+
+	if err := initAnonPrivacy(); err != nil {
+		log.Fatal("Failed to initialize anonim privacy settings:", err)
+	}
+
+	if err := initIdempotency(); err != nil {
+		log.Fatal("Failed to initialize idempotency keys:", err)
+	}
+
+	if err := initRateLimits(); err != nil {
+		log.Fatal("Failed to initialize rate limits:", err)
+	}
+
+	if err := initLiveFeed(); err != nil {
+		log.Fatal("Failed to initialize live feed:", err)
+	}
+
+	// LISTEN for report events from every service (SSE on /laporan/my/events
+	// and the WebSocket feed on /laporan/public/live)
+	if err := initEvents(connStr); err != nil {
+		log.Fatal("Failed to initialize report events:", err)
+	}
+
 	// Setup routes - only laporan endpoints
-	http.HandleFunc("/laporan/public", corsMiddleware(getPublicLaporanHandler))
+	http.HandleFunc("/laporan/public", corsMiddleware(optionalAuthMiddleware(getPublicLaporanHandler)))
+	http.HandleFunc("/laporan/public/live", corsMiddleware(publicLiveFeedHandler))
 	http.HandleFunc("/laporan/my", corsMiddleware(authMiddleware(getMyLaporanHandler)))
-	http.HandleFunc("/laporan", corsMiddleware(authMiddleware(createLaporanHandler)))
+	http.HandleFunc("/laporan/my/events", corsMiddleware(authMiddleware(myLaporanEventsHandler)))
+	http.HandleFunc("/laporan/my/notifications", corsMiddleware(authMiddleware(notificationPreferencesHandler)))
+	http.HandleFunc("/laporan/push/key", corsMiddleware(pushKeyHandler))
+	http.HandleFunc("/laporan/push/subscriptions", corsMiddleware(authMiddleware(pushSubscriptionsHandler)))
+	http.HandleFunc("/laporan/track", corsMiddleware(optionalAuthMiddleware(trackLaporanHandler)))
+	http.HandleFunc("/laporan/track/migrate", corsMiddleware(migrateTrackingCodesHandler))
+	http.HandleFunc("/laporan/duplicates", corsMiddleware(authMiddleware(checkDuplicatesHandler)))
+	http.HandleFunc("/laporan", corsMiddleware(anonTokenOrAuthMiddleware(idempotentMiddleware(createLaporanHandler))))
+	http.HandleFunc("/laporan/", corsMiddleware(laporanItemRouter))
 	http.HandleFunc("/health", healthHandler)
+	// Anonim requests: the same routes under /anonim/, without request metadata
+	http.Handle(anonimPathPrefix+"/", anonimPath(http.DefaultServeMux))
 
 	port := getEnv("PORT", "8080")
 	log.Printf("Service Pembuat Laporan starting on port %s\n", port)
@@ -159,12 +247,15 @@ func corsMiddleware(next http.HandlerFunc) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		// CORS Headers
 		w.Header().Set("Access-Control-Allow-Origin", "*")
-		w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
-		w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization")
-		w.Header().Set("Access-Control-Expose-Headers", "X-Served-By")
-
-		// Load Balancing visibility - show which pod handled this request
-		w.Header().Set("X-Served-By", podHostname)
+		w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, PATCH, DELETE, OPTIONS")
+		w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization, X-Anonim-Hash, X-Anonim-Token, X-Tracking-Code, If-Match, Last-Event-ID, Idempotency-Key")
+		w.Header().Set("Access-Control-Expose-Headers", "X-Served-By, ETag, Idempotent-Replayed, RateLimit-Limit, RateLimit-Remaining, RateLimit-Reset, RateLimit-Policy, Retry-After")
+
+		// Load Balancing visibility - show which pod handled this request,
+		// except on the anonim path where it would help correlate requests
+		if !isAnonimPath(r) {
+			w.Header().Set("X-Served-By", podHostname)
+		}
 
 		// Security Headers
 		w.Header().Set("Content-Security-Policy", "default-src 'self'; script-src 'self'; object-src 'none'")
@@ -188,7 +279,7 @@ func authMiddleware(next http.HandlerFunc) http.HandlerFunc {
 		authHeader := r.Header.Get("Authorization")
 		if authHeader == "" || !strings.HasPrefix(authHeader, "Bearer ") {
 			log.Println("[AUTH ERROR] No token provided in request")
-			http.Error(w, `{"error":"No token provided"}`, http.StatusUnauthorized)
+			writeError(w, http.StatusUnauthorized, ErrCodeTokenMissing, "No token provided")
 			return
 		}
 
@@ -196,20 +287,15 @@ func authMiddleware(next http.HandlerFunc) http.HandlerFunc {
 		log.Println("[AUTH] Verifying warga token...")
 
 		claims := &Claims{}
-		token, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
-			if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-				return nil, fmt.Errorf("unexpected signing method")
-			}
-			return jwtSecret, nil
-		})
+		token, err := jwt.ParseWithClaims(tokenString, claims, jwtKeyFunc)
 
 		if err != nil || !token.Valid {
-			if err == jwt.ErrTokenExpired {
+			if errors.Is(err, jwt.ErrTokenExpired) {
 				log.Println("[AUTH ERROR] Token expired:", err)
-				http.Error(w, `{"error":"Token expired"}`, http.StatusUnauthorized)
+				writeError(w, http.StatusUnauthorized, ErrCodeTokenExpired, "Token expired")
 			} else {
 				log.Println("[AUTH ERROR] Invalid token:", err)
-				http.Error(w, `{"error":"Invalid token"}`, http.StatusUnauthorized)
+				writeError(w, http.StatusUnauthorized, ErrCodeTokenInvalid, "Invalid token")
 			}
 			return
 		}
@@ -217,7 +303,7 @@ func authMiddleware(next http.HandlerFunc) http.HandlerFunc {
 		// Check if user is 'warga' role (hardcoded in token)
 		if claims.Role != "warga" {
 			log.Printf("[AUTH ERROR] Access denied - not warga role (role: %s)\n", claims.Role)
-			http.Error(w, `{"error":"Access denied. Warga only."}`, http.StatusForbidden)
+			writeError(w, http.StatusForbidden, ErrCodeForbiddenRole, "Access denied. Warga only.")
 			return
 		}
 
@@ -226,11 +312,11 @@ func authMiddleware(next http.HandlerFunc) http.HandlerFunc {
 		err = authDB.QueryRow("SELECT id FROM users WHERE id = $1", claims.UserID).Scan(&userID)
 		if err != nil {
 			log.Printf("[AUTH ERROR] User not found in database: userId=%d, error=%v\n", claims.UserID, err)
-			http.Error(w, `{"error":"User not found"}`, http.StatusUnauthorized)
+			writeError(w, http.StatusUnauthorized, ErrCodeUserNotFound, "User not found")
 			return
 		}
 
-		log.Printf("[AUTH SUCCESS] Warga verified: %s (id: %d)\n", claims.NIK, claims.UserID)
+		logRequestf(r, "[AUTH SUCCESS] Warga verified: %s (id: %d)\n", claims.NIK, claims.UserID)
 
 		// Store user info in request context (simplified - store in header for this example)
 		r.Header.Set("X-User-ID", fmt.Sprintf("%d", claims.UserID))
@@ -241,23 +327,130 @@ func authMiddleware(next http.HandlerFunc) http.HandlerFunc {
 	}
 }
 
+// Middleware that attaches the caller's identity when a valid warga token is present,
+// but never rejects the request. Used by public endpoints that personalize their output.
+func optionalAuthMiddleware(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		// Never trust identity headers sent by the client itself
+		r.Header.Del("X-User-ID")
+		r.Header.Del("X-User-NIK")
+		r.Header.Del("X-User-Nama")
+
+		authHeader := r.Header.Get("Authorization")
+		if strings.HasPrefix(authHeader, "Bearer ") {
+			claims := &Claims{}
+			token, err := jwt.ParseWithClaims(strings.TrimPrefix(authHeader, "Bearer "), claims, jwtKeyFunc)
+			if err == nil && token.Valid && claims.Role == "warga" {
+				r.Header.Set("X-User-ID", fmt.Sprintf("%d", claims.UserID))
+				r.Header.Set("X-User-NIK", claims.NIK)
+				r.Header.Set("X-User-Nama", claims.Nama)
+			}
+		}
+
+		next(w, r)
+	}
+}
+
+// jwtKeyFunc only accepts HMAC-signed access tokens
+func jwtKeyFunc(token *jwt.Token) (interface{}, error) {
+	if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
+		return nil, fmt.Errorf("unexpected signing method")
+	}
+	return jwtSecret, nil
+}
+
+// Reporter display choices for publik reports
+const (
+	ReporterDisplayMasked = "masked" // first name + last initial, e.g. "Budi S."
+	ReporterDisplayHidden = "hidden" // generic "Warga"
+)
+
+// Shown when the reporter hid their name or no usable name is available
+const anonymousReporterName = "Warga"
+
+// maskDisplayName turns a full name into "First L." so public listings never show
+// more than a first name and an initial. Anything containing digits is treated as
+// unsafe (it could be a NIK) and replaced with the generic name.
+func maskDisplayName(nama string) string {
+	parts := strings.Fields(nama)
+	if len(parts) == 0 || strings.ContainsAny(nama, "0123456789") {
+		return anonymousReporterName
+	}
+	if len(parts) == 1 {
+		return parts[0]
+	}
+	initial, _ := utf8.DecodeRuneInString(parts[len(parts)-1])
+	return parts[0] + " " + string(unicode.ToUpper(initial)) + "."
+}
+
 // PublicLaporan struct for public response
+// Never add user_nik (or anything derived from it) here - this is served without auth
 type PublicLaporan struct {
-	ID          int       `json:"id"`
-	Title       string    `json:"title"`
-	Description string    `json:"description"`
-	Divisi      string    `json:"divisi"`
-	UserNik     string    `json:"user_nik"`
-	Status      string    `json:"status"`
-	CreatedAt   time.Time `json:"created_at"`
-	UpdatedAt   time.Time `json:"updated_at"`
+	ID           int    `json:"id"`
+	Title        string `json:"title"`
+	Description  string `json:"description"`
+	Divisi       string `json:"divisi"`
+	ReporterName string `json:"reporter_name"`
+	IsMine       bool   `json:"is_mine,omitempty"` // only ever true for the authenticated owner
+	Status       string `json:"status"`
+	SupportCount int    `json:"support_count"`
+	// SupportedByMe is only ever true for an authenticated warga who supports the report
+	SupportedByMe bool      `json:"supported_by_me,omitempty"`
+	Location      *Location `json:"location,omitempty"`
+	DistanceM     *float64  `json:"distance_m,omitempty"` // only for ?near= queries
+	// Only for ?q= searches: HTML-escaped text with matches wrapped in <mark>
+	TitleHighlight string    `json:"title_highlight,omitempty"`
+	Snippet        string    `json:"snippet,omitempty"`
+	CreatedAt      time.Time `json:"created_at"`
+	UpdatedAt      time.Time `json:"updated_at"`
 }
 
-// StatusStats for status breakdown
+// StatusStats for status breakdown, one count per canonical status
 type StatusStats struct {
-	Pending    int `json:"pending"`
-	InProgress int `json:"in_progress"`
-	Completed  int `json:"completed"`
+	Pending   int `json:"pending"`
+	Verified  int `json:"verified"`
+	Diproses  int `json:"diproses"`
+	Selesai   int `json:"selesai"`
+	Ditolak   int `json:"ditolak"`
+	Withdrawn int `json:"withdrawn"`
+}
+
+// add counts reports in status into their bucket
+func (s *StatusStats) add(status string, count int) {
+	switch status {
+	case statusPending:
+		s.Pending += count
+	case statusVerified:
+		s.Verified += count
+	case statusDiproses:
+		s.Diproses += count
+	case statusSelesai:
+		s.Selesai += count
+	case statusDitolak:
+		s.Ditolak += count
+	case statusWithdrawn:
+		s.Withdrawn += count
+	}
+}
+
+// parsePagination reads page/limit query parameters (default 10, max 100 per page)
+func parsePagination(query url.Values) (page, limit, offset int) {
+	page = 1
+	limit = 10 // Default page size
+
+	if p := query.Get("page"); p != "" {
+		if parsed, err := strconv.Atoi(p); err == nil && parsed > 0 {
+			page = parsed
+		}
+	}
+
+	if l := query.Get("limit"); l != "" {
+		if parsed, err := strconv.Atoi(l); err == nil && parsed > 0 && parsed <= 100 {
+			limit = parsed
+		}
+	}
+
+	return page, limit, (page - 1) * limit
 }
 
 // PaginatedResponse for paginated API responses
@@ -270,104 +463,280 @@ type PaginatedResponse struct {
 	Stats      StatusStats     `json:"stats"`
 }
 
+// CursorResponse is returned instead of PaginatedResponse when ?cursor= is used.
+// TotalItems and Stats are only filled in with ?include=totals.
+type CursorResponse struct {
+	Data       []PublicLaporan `json:"data"`
+	Limit      int             `json:"limit"`
+	NextCursor *string         `json:"nextCursor"`
+	PrevCursor *string         `json:"prevCursor"`
+	TotalItems *int            `json:"totalItems,omitempty"`
+	Stats      *StatusStats    `json:"stats,omitempty"`
+}
+
 // GET /laporan/public - Get all public reports with pagination (no auth required)
+// Page mode (?page=&limit=) is the default; ?cursor= switches to keyset pagination,
+// starting with an empty cursor and following nextCursor/prevCursor.
 func getPublicLaporanHandler(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodGet {
 		log.Println("[GET PUBLIC LAPORAN ERROR] Invalid method:", r.Method)
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		writeMethodNotAllowed(w)
 		return
 	}
 
-	// Parse pagination parameters
 	query := r.URL.Query()
-	page := 1
-	limit := 10 // Default page size
 
-	if p := query.Get("page"); p != "" {
-		if parsed, err := strconv.Atoi(p); err == nil && parsed > 0 {
-			page = parsed
-		}
+	// Parse pagination parameters
+	page, limit, offset := parsePagination(query)
+
+	geo, fields := parseGeoFilter(query)
+	if len(fields) > 0 {
+		writeFieldError(w, http.StatusBadRequest, ErrCodeValidationFailed, "Invalid location filter", fields)
+		return
 	}
+	geoJSON := query.Get("format") == "geojson"
 
-	if l := query.Get("limit"); l != "" {
-		if parsed, err := strconv.Atoi(l); err == nil && parsed > 0 && parsed <= 100 {
-			limit = parsed
-		}
+	q := strings.TrimSpace(query.Get("q"))
+	if utf8.RuneCountInString(q) > maxSearchQueryLength {
+		writeFieldError(w, http.StatusBadRequest, ErrCodeValidationFailed, "Search query is too long",
+			map[string]string{"q": fmt.Sprintf("must be at most %d characters", maxSearchQueryLength)})
+		return
 	}
 
-	offset := (page - 1) * limit
+	divisiFilter, ok := parseDivisiFilter(query)
+	if !ok {
+		writeFieldError(w, http.StatusBadRequest, ErrCodeDivisiInvalid, "Divisi must be one of: kebersihan, kesehatan, fasilitas umum, kriminalitas", map[string]string{"divisi": "must be one of: kebersihan, kesehatan, fasilitas umum, kriminalitas"})
+		return
+	}
+	statusFilter, ok := parseStatusFilter(query)
+	if !ok {
+		writeFieldError(w, http.StatusBadRequest, ErrCodeStatusInvalid, "Status must be one of: "+statusList, map[string]string{"status": "must be one of: " + statusList})
+		return
+	}
 
-	log.Printf("[GET PUBLIC LAPORAN] Fetching public reports - page: %d, limit: %d, offset: %d\n", page, limit, offset)
+	// Default order: nearest first for ?near=, best match first for ?q=, otherwise newest first
+	sort := query.Get("sort")
+	switch {
+	case sort == "" && geo != nil && geo.Near:
+		sort = "distance"
+	case sort == "" && q != "":
+		sort = "relevance"
+	case sort == "":
+		sort = "newest"
+	}
+	if _, known := publicSortOrders[sort]; !known && !(sort == "distance" && geo != nil && geo.Near) && !(sort == "relevance" && q != "") {
+		writeFieldError(w, http.StatusBadRequest, ErrCodeValidationFailed, "Invalid sort",
+			map[string]string{"sort": "must be one of: newest, oldest, updated, supported, relevance (with q), distance (with near)"})
+		return
+	}
 
-	// Get total count
-	var totalItems int
-	err := db.QueryRow(`SELECT COUNT(*) FROM laporan WHERE tipe = 'publik'`).Scan(&totalItems)
-	if err != nil {
-		log.Println("[GET PUBLIC LAPORAN ERROR] Count query error:", err)
-		http.Error(w, `{"error":"Failed to count public laporan"}`, http.StatusInternalServerError)
+	log.Printf("[GET PUBLIC LAPORAN] Fetching public reports - page: %d, limit: %d, offset: %d, sort: %s\n", page, limit, offset, sort)
+
+	var args []interface{}
+	arg := func(v interface{}) string {
+		args = append(args, v)
+		return fmt.Sprintf("$%d", len(args))
+	}
+	where := "tipe = 'publik' AND status <> '" + statusWithdrawn + "'"
+	if geo != nil {
+		where += " AND " + geo.where(arg)
+	} else if geoJSON {
+		// A map can only place reports that have a location
+		where += " AND latitude IS NOT NULL"
+	}
+	// Search only ever runs inside the tipe = 'publik' condition above
+	var tsQuery string
+	if q != "" {
+		tsQuery = searchQuery(q, arg)
+		where += " AND search_vector @@ " + tsQuery
+	}
+	if len(divisiFilter) > 0 {
+		where += " AND divisi::text = ANY(" + arg(pq.Array(divisiFilter)) + ")"
+	}
+	// Stats use the same status filter as the list so the dashboard numbers match it
+	if len(statusFilter) > 0 {
+		where += " AND status = ANY(" + arg(pq.Array(statusFilter)) + "::status_laporan_enum[])"
+	}
+	fields = map[string]string{}
+	where += timeRangeWhere(query, "created", "created_at", arg, fields)
+	where += timeRangeWhere(query, "updated", "updated_at", arg, fields)
+	if len(fields) > 0 {
+		writeFieldError(w, http.StatusBadRequest, ErrCodeValidationFailed, "Invalid date range", fields)
 		return
 	}
 
-	// Get status counts for stats
+	// Cursor mode skips totals unless asked for; page mode always returns them (cached)
+	cursorMode := query.Has("cursor")
+	var totalItems int
 	var stats StatusStats
-	rows, err := db.Query(`
-		SELECT status, COUNT(*) as count 
-		FROM laporan 
-		WHERE tipe = 'publik'
-		GROUP BY status
-	`)
-	if err != nil {
-		log.Println("[GET PUBLIC LAPORAN ERROR] Stats query error:", err)
-		http.Error(w, `{"error":"Failed to fetch status stats"}`, http.StatusInternalServerError)
-		return
+	withTotals := !cursorMode || wantTotals(query.Get("include"))
+	if withTotals {
+		var err error
+		totalItems, stats, err = publicTotals(where, args)
+		if err != nil {
+			log.Println("[GET PUBLIC LAPORAN ERROR] Totals query error:", err)
+			writeError(w, http.StatusInternalServerError, ErrCodeInternal, "Failed to count public laporan")
+			return
+		}
 	}
 
-	for rows.Next() {
-		var status string
-		var count int
-		if err := rows.Scan(&status, &count); err != nil {
-			log.Println("[GET PUBLIC LAPORAN ERROR] Stats scan error:", err)
-			continue
+	var keyset keysetOrder
+	var cursor pageCursor
+	if cursorMode {
+		var known bool
+		if keyset, known = keysetOrders[sort]; !known {
+			writeFieldError(w, http.StatusBadRequest, ErrCodeValidationFailed, "Sort does not support cursor pagination",
+				map[string]string{"sort": "must be one of: newest, oldest, updated when using cursor"})
+			return
 		}
-		switch status {
-		case "pending":
-			stats.Pending = count
-		case "in_progress", "diproses":
-			stats.InProgress += count
-		case "completed", "selesai":
-			stats.Completed += count
+		if raw := query.Get("cursor"); raw != "" {
+			var err error
+			if cursor, err = decodeCursor(raw, sort); err != nil {
+				writeFieldError(w, http.StatusBadRequest, ErrCodeCursorInvalid, "Invalid cursor", map[string]string{"cursor": "invalid or issued for a different sort"})
+				return
+			}
+			where += " AND " + keyset.where(cursor, arg)
 		}
 	}
-	rows.Close()
 
-	// Get paginated data
-	rows, err = db.Query(`
-		SELECT id, title, description, divisi, user_nik, status, created_at, updated_at 
+	// Caller's NIK (only set by optionalAuthMiddleware for a valid token) to flag their own reports
+	callerNIK := r.Header.Get("X-User-NIK")
+
+	distance := "NULL::float8"
+	titleHighlight, snippet := "''", "''"
+	if tsQuery != "" {
+		titleHighlight = headline("title", tsQuery, titleHeadlineOptions, arg)
+		snippet = headline("description", tsQuery, snippetHeadlineOptions, arg)
+	}
+	if geo != nil && geo.Near {
+		distance = geo.distance(arg)
+	}
+	supportedByMe := "false"
+	if callerNIK != "" {
+		supportedByMe = "EXISTS (SELECT 1 FROM laporan_supports s WHERE s.laporan_id = laporan.id AND s.voter_nik = " + arg(callerNIK) + ")"
+	}
+	orderBy := publicSortOrders[sort]
+	pageClause := ` LIMIT ` + arg(limit) + ` OFFSET ` + arg(offset)
+	if cursorMode {
+		// One extra row tells whether there is another page in this direction
+		orderBy = keyset.orderBy(cursor.Before)
+		pageClause = ` LIMIT ` + arg(limit+1)
+	}
+	switch sort {
+	case "relevance":
+		orderBy = "ts_rank_cd(search_vector, " + tsQuery + ") DESC, created_at DESC, id DESC"
+	case "distance":
+		orderBy = "distance_m, created_at DESC, id DESC"
+	}
+	dataQuery := `
+		SELECT id, title, description, tipe, divisi, COALESCE(reporter_display, ` + arg(anonymousReporterName) + `), user_nik, status,
+		       support_count, ` + supportedByMe + `,
+		       latitude, longitude, location_accuracy_m, ` + distance + ` AS distance_m,
+		       ` + titleHighlight + `, ` + snippet + `, created_at, updated_at
 		FROM laporan 
-		WHERE tipe = 'publik'
-		ORDER BY created_at DESC
-		LIMIT $1 OFFSET $2
-	`, limit, offset)
+		WHERE ` + where + `
+		ORDER BY ` + orderBy + pageClause
+
+	// Get paginated data
+	rows, err := db.Query(dataQuery, args...)
 	if err != nil {
 		log.Println("[GET PUBLIC LAPORAN ERROR] Database query error:", err)
-		http.Error(w, `{"error":"Failed to fetch public laporan"}`, http.StatusInternalServerError)
+		writeError(w, http.StatusInternalServerError, ErrCodeInternal, "Failed to fetch public laporan")
 		return
 	}
 	defer rows.Close()
 
-	var laporanList []PublicLaporan
+	laporanList := []PublicLaporan{}
 	for rows.Next() {
 		var l PublicLaporan
-		if err := rows.Scan(&l.ID, &l.Title, &l.Description, &l.Divisi, &l.UserNik, &l.Status, &l.CreatedAt, &l.UpdatedAt); err != nil {
+		var tipe string
+		var ownerNIK sql.NullString
+		var lat, lng, accuracy *float64
+		if err := rows.Scan(&l.ID, &l.Title, &l.Description, &tipe, &l.Divisi, &l.ReporterName, &ownerNIK, &l.Status,
+			&l.SupportCount, &l.SupportedByMe, &lat, &lng, &accuracy, &l.DistanceM, &l.TitleHighlight, &l.Snippet, &l.CreatedAt, &l.UpdatedAt); err != nil {
 			log.Println("[GET PUBLIC LAPORAN ERROR] Scan error:", err)
 			continue
 		}
+		if q != "" {
+			l.TitleHighlight = highlightHTML(l.TitleHighlight)
+			l.Snippet = highlightHTML(l.Snippet)
+		}
+		l.IsMine = callerNIK != "" && ownerNIK.Valid && ownerNIK.String == callerNIK
+		l.Location = publicLocation(tipe, scanLocation(lat, lng, accuracy))
 		laporanList = append(laporanList, l)
 	}
 
+	if err := rows.Err(); err != nil {
+		log.Println("[GET PUBLIC LAPORAN ERROR] Rows error:", err)
+		writeError(w, http.StatusInternalServerError, ErrCodeInternal, "Failed to fetch public laporan")
+		return
+	}
+
+	if cursorMode {
+		response := CursorResponse{Limit: limit}
+		hasMore := len(laporanList) > limit
+		if hasMore {
+			laporanList = laporanList[:limit]
+		}
+		if cursor.Before {
+			// Prev pages were read in reverse order
+			for i, j := 0, len(laporanList)-1; i < j; i, j = i+1, j-1 {
+				laporanList[i], laporanList[j] = laporanList[j], laporanList[i]
+			}
+		}
+		if len(laporanList) > 0 {
+			first, last := laporanList[0], laporanList[len(laporanList)-1]
+			// There is a previous page if we came from one (any non-empty cursor) or read backwards with more rows left
+			if (cursor.ID != 0 && !cursor.Before) || (cursor.Before && hasMore) {
+				prev := encodeCursor(pageCursor{Sort: sort, Time: keyset.key(first), ID: first.ID, Before: true})
+				response.PrevCursor = &prev
+			}
+			if cursor.Before || hasMore {
+				next := encodeCursor(pageCursor{Sort: sort, Time: keyset.key(last), ID: last.ID})
+				response.NextCursor = &next
+			}
+		}
+		response.Data = laporanList
+		if withTotals {
+			response.TotalItems = &totalItems
+			response.Stats = &stats
+		}
+
+		log.Printf("[GET PUBLIC LAPORAN] Found %d public reports (cursor mode, more: %v)\n", len(laporanList), hasMore)
+
+		if geoJSON {
+			w.Header().Set("Content-Type", "application/geo+json")
+			json.NewEncoder(w).Encode(GeoJSONFeatureCollection{
+				Type:       "FeatureCollection",
+				Features:   geoJSONFeatures(laporanList),
+				Limit:      limit,
+				NextCursor: response.NextCursor,
+				PrevCursor: response.PrevCursor,
+				TotalItems: response.TotalItems,
+			})
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(response)
+		return
+	}
+
 	// Calculate total pages
 	totalPages := (totalItems + limit - 1) / limit
 
+	if geoJSON {
+		w.Header().Set("Content-Type", "application/geo+json")
+		json.NewEncoder(w).Encode(GeoJSONFeatureCollection{
+			Type:       "FeatureCollection",
+			Features:   geoJSONFeatures(laporanList),
+			Page:       page,
+			Limit:      limit,
+			TotalItems: &totalItems,
+			TotalPages: totalPages,
+		})
+		return
+	}
+
 	response := PaginatedResponse{
 		Data:       laporanList,
 		Page:       page,
@@ -377,8 +746,8 @@ func getPublicLaporanHandler(w http.ResponseWriter, r *http.Request) {
 		Stats:      stats,
 	}
 
-	log.Printf("[GET PUBLIC LAPORAN] Found %d public reports (page %d of %d) - Stats: pending=%d, in_progress=%d, completed=%d\n",
-		len(laporanList), page, totalPages, stats.Pending, stats.InProgress, stats.Completed)
+	log.Printf("[GET PUBLIC LAPORAN] Found %d public reports (page %d of %d) - Stats: pending=%d, diproses=%d, selesai=%d\n",
+		len(laporanList), page, totalPages, stats.Pending, stats.Diproses, stats.Selesai)
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(response)
@@ -386,134 +755,242 @@ func getPublicLaporanHandler(w http.ResponseWriter, r *http.Request) {
 
 // Struct for user's own laporan (includes all fields)
 type MyLaporan struct {
-	ID          int       `json:"id"`
-	Title       string    `json:"title"`
-	Description string    `json:"description"`
-	Tipe        string    `json:"tipe"`
-	Divisi      string    `json:"divisi"`
-	Status      string    `json:"status"`
-	CreatedAt   time.Time `json:"created_at"`
-	UpdatedAt   time.Time `json:"updated_at"`
+	ID          int    `json:"id"`
+	Title       string `json:"title"`
+	Description string `json:"description"`
+	Tipe        string `json:"tipe"`
+	Divisi      string `json:"divisi"`
+	Status      string `json:"status"`
+	Version     int    `json:"version"`
+	// SupportCount is the number of warga who support the report (publik only)
+	SupportCount int       `json:"support_count"`
+	Location     *Location `json:"location,omitempty"` // exact; only the owner sees this
+	CreatedAt    time.Time `json:"created_at"`
+	UpdatedAt    time.Time `json:"updated_at"`
+	// StatusHistory is the status timeline, oldest first (GET /laporan/my only)
+	StatusHistory []StatusChange `json:"status_history,omitempty"`
 }
 
+// MyLaporanResponse is the paginated response for GET /laporan/my
+type MyLaporanResponse struct {
+	Data       []MyLaporan `json:"data"`
+	Page       int         `json:"page"`
+	Limit      int         `json:"limit"`
+	TotalItems int         `json:"totalItems"`
+	TotalPages int         `json:"totalPages"`
+	Stats      StatusStats `json:"stats"`
+}
+
+// Header carrying the anonim credential (client-side NIK+password hash).
+// Sent as a header rather than a query param so it never ends up in access logs.
+const anonCredentialHeader = "X-Anonim-Hash"
+
 // GET /laporan/my - Get user's own reports (requires auth)
+// publik/private reports are scoped to the NIK in the token; anonim reports are only
+// returned to a caller who also presents the anonim credential in X-Anonim-Hash.
+// Query params: filter (nik|hash|all), status, divisi, page, limit
 func getMyLaporanHandler(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodGet {
 		log.Println("[GET MY LAPORAN ERROR] Invalid method:", r.Method)
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		writeMethodNotAllowed(w)
 		return
 	}
 
-	// Get query parameters
+	// Identity comes only from the verified token (set by authMiddleware)
+	userNik := r.Header.Get("X-User-NIK")
+	anonHash := r.Header.Get(anonCredentialHeader)
+
 	query := r.URL.Query()
-	userNik := query.Get("user_nik")
-	userHash := query.Get("user_hash")
 	filter := query.Get("filter")
+	statusFilter := query.Get("status")
+	divisiFilter := query.Get("divisi")
+	page, limit, offset := parsePagination(query)
 
-	log.Printf("[GET MY LAPORAN] Filter: %s, user_nik: %s, user_hash: %s\n", filter, userNik, userHash)
+	log.Printf("[GET MY LAPORAN] Filter: %s, status: %s, divisi: %s, page: %d, limit: %d\n", filter, statusFilter, divisiFilter, page, limit)
 
-	var rows *sql.Rows
-	var err error
+	var args []interface{}
+	arg := func(v interface{}) string {
+		args = append(args, v)
+		return fmt.Sprintf("$%d", len(args))
+	}
 
+	// Ownership scope
+	var scope string
 	switch filter {
-	case "nik":
-		// Get only public & private reports by NIK
-		if userNik == "" {
-			http.Error(w, `{"error":"user_nik is required for NIK filter"}`, http.StatusBadRequest)
+	case "", "nik":
+		scope = "(user_nik = " + arg(userNik) + " AND tipe IN ('publik', 'private'))"
+	case "hash":
+		if anonHash == "" {
+			writeFieldError(w, http.StatusBadRequest, ErrCodeAnonCredentialRequired, anonCredentialHeader+" header is required for hash filter", map[string]string{anonCredentialHeader: "required"})
 			return
 		}
-		rows, err = db.Query(`
-			SELECT id, title, description, tipe, divisi, status, created_at, updated_at 
-			FROM laporan 
-			WHERE user_nik = $1 AND tipe IN ('publik', 'private')
-			ORDER BY created_at DESC
-		`, userNik)
+		scope = "(user_nik = " + arg(anonHash) + " AND tipe = 'anonim')"
+	case "all":
+		scope = "(user_nik = " + arg(userNik) + " AND tipe IN ('publik', 'private'))"
+		if anonHash != "" {
+			scope = "(" + scope + " OR (user_nik = " + arg(anonHash) + " AND tipe = 'anonim'))"
+		}
+	default:
+		writeFieldError(w, http.StatusBadRequest, ErrCodeValidationFailed, "filter must be one of: nik, hash, all", map[string]string{"filter": "must be one of: nik, hash, all"})
+		return
+	}
 
-	case "hash":
-		// Get only anonim reports by hash
-		if userHash == "" {
-			http.Error(w, `{"error":"user_hash is required for hash filter"}`, http.StatusBadRequest)
+	// Stats are computed over the scope and divisi, but not the status filter,
+	// so the per-status counts stay meaningful while browsing one status
+	where := scope
+	if divisiFilter != "" {
+		if !validDivisi[divisiFilter] {
+			writeFieldError(w, http.StatusBadRequest, ErrCodeDivisiInvalid, "Divisi must be one of: kebersihan, kesehatan, fasilitas umum, kriminalitas", map[string]string{"divisi": "must be one of: kebersihan, kesehatan, fasilitas umum, kriminalitas"})
 			return
 		}
-		rows, err = db.Query(`
-			SELECT id, title, description, tipe, divisi, status, created_at, updated_at 
-			FROM laporan 
-			WHERE user_nik = $1 AND tipe = 'anonim'
-			ORDER BY created_at DESC
-		`, userHash)
-
-	case "all":
-		// Get all reports (by NIK for public/private, by hash for anonim)
-		if userNik == "" {
-			http.Error(w, `{"error":"user_nik is required for all filter"}`, http.StatusBadRequest)
+		where += " AND divisi = " + arg(divisiFilter)
+	}
+	// Owners can search all their own reports, including private and anonim
+	if q := strings.TrimSpace(query.Get("q")); q != "" {
+		if utf8.RuneCountInString(q) > maxSearchQueryLength {
+			writeFieldError(w, http.StatusBadRequest, ErrCodeValidationFailed, "Search query is too long",
+				map[string]string{"q": fmt.Sprintf("must be at most %d characters", maxSearchQueryLength)})
 			return
 		}
-		if userHash != "" {
-			// User has both NIK and hash - get all their reports
-			rows, err = db.Query(`
-				SELECT id, title, description, tipe, divisi, status, created_at, updated_at 
-				FROM laporan 
-				WHERE (user_nik = $1 AND tipe IN ('publik', 'private')) OR (user_nik = $2 AND tipe = 'anonim')
-				ORDER BY created_at DESC
-			`, userNik, userHash)
-		} else {
-			// User only has NIK - get public/private reports
-			rows, err = db.Query(`
-				SELECT id, title, description, tipe, divisi, status, created_at, updated_at 
-				FROM laporan 
-				WHERE user_nik = $1 AND tipe IN ('publik', 'private')
-				ORDER BY created_at DESC
-			`, userNik)
+		where += " AND search_vector @@ " + searchQuery(q, arg)
+	}
+
+	var stats StatusStats
+	rows, err := db.Query(`SELECT status, COUNT(*) FROM laporan WHERE `+where+` GROUP BY status`, args...)
+	if err != nil {
+		log.Println("[GET MY LAPORAN ERROR] Stats query error:", err)
+		writeError(w, http.StatusInternalServerError, ErrCodeInternal, "Failed to fetch status stats")
+		return
+	}
+	for rows.Next() {
+		var status string
+		var count int
+		if err := rows.Scan(&status, &count); err != nil {
+			log.Println("[GET MY LAPORAN ERROR] Stats scan error:", err)
+			continue
 		}
+		stats.add(status, count)
+	}
+	rows.Close()
 
-	default:
-		// Default: filter by NIK for public/private
-		if userNik == "" {
-			http.Error(w, `{"error":"user_nik is required"}`, http.StatusBadRequest)
+	if statusFilter != "" {
+		if !validStatus[statusFilter] {
+			writeFieldError(w, http.StatusBadRequest, ErrCodeStatusInvalid, "Status must be one of: "+statusList, map[string]string{"status": "must be one of: " + statusList})
 			return
 		}
-		rows, err = db.Query(`
-			SELECT id, title, description, tipe, divisi, status, created_at, updated_at 
-			FROM laporan 
-			WHERE user_nik = $1 AND tipe IN ('publik', 'private')
-			ORDER BY created_at DESC
-		`, userNik)
+		where += " AND status = " + arg(statusFilter) + "::status_laporan_enum"
+	}
+
+	var totalItems int
+	if err := db.QueryRow(`SELECT COUNT(*) FROM laporan WHERE `+where, args...).Scan(&totalItems); err != nil {
+		log.Println("[GET MY LAPORAN ERROR] Count query error:", err)
+		writeError(w, http.StatusInternalServerError, ErrCodeInternal, "Failed to count laporan")
+		return
 	}
 
+	dataQuery := `
+		SELECT id, title, description, tipe, divisi, status, version, support_count, latitude, longitude, location_accuracy_m, created_at, updated_at 
+		FROM laporan 
+		WHERE ` + where + `
+		ORDER BY created_at DESC
+		LIMIT ` + arg(limit) + ` OFFSET ` + arg(offset)
+	rows, err = db.Query(dataQuery, args...)
 	if err != nil {
 		log.Println("[GET MY LAPORAN ERROR] Database query error:", err)
-		http.Error(w, `{"error":"Failed to fetch laporan"}`, http.StatusInternalServerError)
+		writeError(w, http.StatusInternalServerError, ErrCodeInternal, "Failed to fetch laporan")
 		return
 	}
 	defer rows.Close()
 
-	var laporanList []MyLaporan
+	laporanList := []MyLaporan{}
 	for rows.Next() {
 		var l MyLaporan
-		if err := rows.Scan(&l.ID, &l.Title, &l.Description, &l.Tipe, &l.Divisi, &l.Status, &l.CreatedAt, &l.UpdatedAt); err != nil {
+		var lat, lng, accuracy *float64
+		if err := rows.Scan(&l.ID, &l.Title, &l.Description, &l.Tipe, &l.Divisi, &l.Status, &l.Version, &l.SupportCount, &lat, &lng, &accuracy, &l.CreatedAt, &l.UpdatedAt); err != nil {
 			log.Println("[GET MY LAPORAN ERROR] Scan error:", err)
 			continue
 		}
+		l.Location = scanLocation(lat, lng, accuracy)
 		laporanList = append(laporanList, l)
 	}
 
-	log.Printf("[GET MY LAPORAN] Found %d reports\n", len(laporanList))
+	ids := make([]int, len(laporanList))
+	for i, l := range laporanList {
+		ids[i] = l.ID
+	}
+	history, err := loadStatusHistory(ids)
+	if err != nil {
+		log.Println("[GET MY LAPORAN ERROR] Status history error:", err)
+		writeError(w, http.StatusInternalServerError, ErrCodeInternal, "Failed to fetch laporan")
+		return
+	}
+	for i := range laporanList {
+		laporanList[i].StatusHistory = history[laporanList[i].ID]
+	}
+
+	totalPages := (totalItems + limit - 1) / limit
+
+	log.Printf("[GET MY LAPORAN] Found %d reports (page %d of %d)\n", len(laporanList), page, totalPages)
 
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(laporanList)
+	json.NewEncoder(w).Encode(MyLaporanResponse{
+		Data:       laporanList,
+		Page:       page,
+		Limit:      limit,
+		TotalItems: totalItems,
+		TotalPages: totalPages,
+		Stats:      stats,
+	})
 }
 
+// Allowed values for laporan.tipe and laporan.divisi (mirror the DB enums)
+var validTipe = map[string]bool{"publik": true, "private": true, "anonim": true}
+var validDivisi = map[string]bool{"kebersihan": true, "kesehatan": true, "fasilitas umum": true, "kriminalitas": true}
+
 func createLaporanHandler(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
 		log.Println("[CREATE LAPORAN ERROR] Invalid method:", r.Method)
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		writeMethodNotAllowed(w)
 		return
 	}
 
+	// Accept JSON, or multipart/form-data when the report comes with attachments
 	var req CreateLaporanRequest
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if mediaType == "multipart/form-data" {
+		if !parseUploadForm(w, r) {
+			return
+		}
+		defer r.MultipartForm.RemoveAll()
+		req = CreateLaporanRequest{
+			Title:            r.FormValue("title"),
+			Description:      r.FormValue("description"),
+			Tipe:             r.FormValue("tipe"),
+			Divisi:           r.FormValue("divisi"),
+			ReporterDisplay:  r.FormValue("reporterDisplay"),
+			LocationConsent:  r.FormValue("locationConsent") == "true",
+			IgnoreDuplicates: r.FormValue("ignoreDuplicates") == "true",
+			NotifyEmail:      r.FormValue("notifyEmail"),
+			NotifyLocale:     r.FormValue("notifyLocale"),
+		}
+		fields := map[string]string{}
+		for name, dst := range map[string]**float64{"latitude": &req.Latitude, "longitude": &req.Longitude, "locationAccuracy": &req.LocationAccuracy} {
+			if v := r.FormValue(name); v != "" {
+				f, err := strconv.ParseFloat(v, 64)
+				if err != nil {
+					fields[name] = "must be a number"
+					continue
+				}
+				*dst = &f
+			}
+		}
+		if len(fields) > 0 {
+			writeFieldError(w, http.StatusBadRequest, ErrCodeValidationFailed, "Invalid location", fields)
+			return
+		}
+	} else if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		log.Println("[CREATE LAPORAN ERROR] Invalid request body:", err)
-		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		writeError(w, http.StatusBadRequest, ErrCodeInvalidRequestBody, "Invalid request body")
 		return
 	}
 
@@ -524,52 +1001,214 @@ func createLaporanHandler(w http.ResponseWriter, r *http.Request) {
 	// Validate input
 	if req.Title == "" || req.Description == "" {
 		log.Println("[CREATE LAPORAN ERROR] Missing title or description")
-		http.Error(w, "Title and description are required", http.StatusBadRequest)
+		fields := map[string]string{}
+		if req.Title == "" {
+			fields["title"] = "required"
+		}
+		if req.Description == "" {
+			fields["description"] = "required"
+		}
+		writeFieldError(w, http.StatusBadRequest, ErrCodeValidationFailed, "Title and description are required", fields)
 		return
 	}
 
 	// Validate tipe enum
-	validTipe := map[string]bool{"publik": true, "private": true, "anonim": true}
 	if !validTipe[req.Tipe] {
 		log.Println("[CREATE LAPORAN ERROR] Invalid tipe:", req.Tipe)
-		http.Error(w, "Tipe must be one of: publik, private, anonim", http.StatusBadRequest)
+		writeFieldError(w, http.StatusBadRequest, ErrCodeTipeInvalid, "Tipe must be one of: publik, private, anonim", map[string]string{"tipe": "must be one of: publik, private, anonim"})
+		return
+	}
+
+	// Anonim reports come with an anonim token and never an access token, so the request
+	// carries nothing that identifies the reporter. Every other tipe needs the access token.
+	var anonTokenHash string
+	if req.Tipe == "anonim" {
+		if anonTokenKey == nil {
+			writeError(w, http.StatusServiceUnavailable, ErrCodeAnonTokensDisabled, "Anonim reports are not available")
+			return
+		}
+		if !isAnonimPath(r) {
+			writeError(w, http.StatusBadRequest, ErrCodeAnonPathRequired, "Anonim reports are sent to "+anonimPathPrefix+"/laporan")
+			return
+		}
+		if userNIK != "" {
+			writeFieldError(w, http.StatusBadRequest, ErrCodeAnonTokenRequired, "Anonim reports are sent with an anonim token instead of an access token", map[string]string{anonTokenHeader: "required, without Authorization"})
+			return
+		}
+		var ok bool
+		if anonTokenHash, ok = verifyAnonToken(r.Header.Get(anonTokenHeader)); !ok {
+			log.Println("[CREATE LAPORAN ERROR] Invalid anonim token")
+			writeError(w, http.StatusUnauthorized, ErrCodeAnonTokenInvalid, "Invalid anonim token")
+			return
+		}
+	} else if isAnonimPath(r) {
+		// The anonim path drops the client address, which the IP quota needs
+		writeError(w, http.StatusBadRequest, ErrCodeAnonPathAnonimOnly, "Only anonim reports are sent to "+anonimPathPrefix+"/laporan")
+		return
+	} else if userNIK == "" {
+		writeError(w, http.StatusUnauthorized, ErrCodeTokenMissing, "No token provided")
 		return
 	}
 
 	// Validate divisi enum
-	validDivisi := map[string]bool{"kebersihan": true, "kesehatan": true, "fasilitas umum": true, "kriminalitas": true}
 	if !validDivisi[req.Divisi] {
 		log.Println("[CREATE LAPORAN ERROR] Invalid divisi:", req.Divisi)
-		http.Error(w, "Divisi must be one of: kebersihan, kesehatan, fasilitas umum, kriminalitas", http.StatusBadRequest)
+		writeFieldError(w, http.StatusBadRequest, ErrCodeDivisiInvalid, "Divisi must be one of: kebersihan, kesehatan, fasilitas umum, kriminalitas", map[string]string{"divisi": "must be one of: kebersihan, kesehatan, fasilitas umum, kriminalitas"})
 		return
 	}
 
-	// Determine user identifier to store
-	// For anonim reports, use the hash provided by frontend (NIK+password hashed client-side)
-	// Server never sees the password - only the hash
-	var userIdentifier string
+	location, fields := validateLocation(req.Latitude, req.Longitude, req.LocationAccuracy)
+	if len(fields) > 0 {
+		log.Println("[CREATE LAPORAN ERROR] Invalid location")
+		writeFieldError(w, http.StatusBadRequest, ErrCodeValidationFailed, "Invalid location", fields)
+		return
+	}
+
+	if req.Tipe != "anonim" && (req.NotifyEmail != "" || req.NotifyLocale != "") {
+		writeFieldError(w, http.StatusBadRequest, ErrCodeValidationFailed, "notifyEmail is only used for anonim reports", map[string]string{"notifyEmail": "only for anonim reports"})
+		return
+	}
+	if fields := validateNotifyEmail(req.NotifyEmail, req.NotifyLocale); len(fields) > 0 {
+		writeFieldError(w, http.StatusBadRequest, ErrCodeValidationFailed, "Invalid notification contact", fields)
+		return
+	}
+	if req.NotifyLocale == "" {
+		req.NotifyLocale = defaultNotificationPreferences.Locale
+	}
+
+	// Validate attachments before anything is written
+	uploads, uerr := readUploads(r.MultipartForm, req.Tipe, 0, req.LocationConsent)
+	if uerr != nil {
+		log.Println("[CREATE LAPORAN ERROR] Attachment rejected:", uerr.Message)
+		writeFieldError(w, uerr.Status, uerr.Code, uerr.Message, map[string]string{uerr.Field: uerr.Message})
+		return
+	}
+
+	// Validate reporter display choice
+	if req.ReporterDisplay == "" {
+		req.ReporterDisplay = ReporterDisplayMasked
+	}
+	if req.ReporterDisplay != ReporterDisplayMasked && req.ReporterDisplay != ReporterDisplayHidden {
+		log.Println("[CREATE LAPORAN ERROR] Invalid reporterDisplay:", req.ReporterDisplay)
+		writeFieldError(w, http.StatusBadRequest, ErrCodeValidationFailed, "reporterDisplay must be one of: masked, hidden", map[string]string{"reporterDisplay": "must be one of: masked, hidden"})
+		return
+	}
+
+	// Without a device position, fall back to the first photo's GPS (only ever
+	// extracted for publik reports with location consent)
+	if location == nil {
+		for _, u := range uploads {
+			if u.Location != nil {
+				location = &Location{Latitude: u.Location.Latitude, Longitude: u.Location.Longitude}
+				break
+			}
+		}
+	}
+	var lat, lng, accuracy *float64
+	if location != nil {
+		lat, lng, accuracy = &location.Latitude, &location.Longitude, location.AccuracyM
+	}
+
+	// Look for likely duplicates before anything is written
+	duplicates, err := findDuplicates(req.Title, req.Description, req.Divisi, location, userNIK)
+	if err != nil {
+		log.Println("[CREATE LAPORAN ERROR] Duplicate check failed:", err)
+		writeError(w, http.StatusInternalServerError, ErrCodeInternal, "Failed to create laporan")
+		return
+	}
+	if len(duplicates) > 0 && (duplicateCheckMode == duplicateModeBlock ||
+		(duplicateCheckMode == duplicateModeWarn && !req.IgnoreDuplicates)) {
+		logRequestf(r, "[CREATE LAPORAN] Rejected as possible duplicate of laporan %d (mode %s)\n", duplicates[0].ID, duplicateCheckMode)
+		writeDuplicateSuspected(w, duplicates)
+		return
+	}
+
+	// Quotas only count requests that would create a report; anonim reports are
+	// bounded by the anonim token allowance instead
+	if req.Tipe != "anonim" && !checkReportRateLimits(w, r, userNIK, req.Divisi, isTrustedReporter(userNIK)) {
+		return
+	}
+
+	// Only publik reports carry a display name; private/anonim never store one
+	var reporterDisplay sql.NullString
+	if req.Tipe == "publik" {
+		reporterDisplay.Valid = true
+		reporterDisplay.String = anonymousReporterName
+		if req.ReporterDisplay == ReporterDisplayMasked {
+			reporterDisplay.String = maskDisplayName(userNama)
+		}
+	}
+
+	// Anonim reports are not linked to the account at all. The reporter gets a tracking
+	// code once in the response; only its hash is stored.
+	var userIdentifier sql.NullString
+	var trackingCode, trackingCodeHash string
 	if req.Tipe == "anonim" {
-		if req.UserNikHash == "" {
-			log.Println("[CREATE LAPORAN ERROR] userNikHash required for anonymous reports")
-			http.Error(w, "Hash NIK+password diperlukan untuk laporan anonim", http.StatusBadRequest)
+		trackingCode, trackingCodeHash, err = newTrackingCode()
+		if err != nil {
+			log.Println("[CREATE LAPORAN ERROR] Tracking code:", err)
+			writeError(w, http.StatusInternalServerError, ErrCodeInternal, "Failed to create laporan")
 			return
 		}
-		userIdentifier = req.UserNikHash
-		log.Printf("[CREATE LAPORAN] Anonim report - using client-side hash\n")
 	} else {
-		userIdentifier = userNIK
+		userIdentifier = sql.NullString{String: userNIK, Valid: true}
+	}
+
+	// Insert report and attachment metadata in one transaction
+	tx, err := db.Begin()
+	if err != nil {
+		log.Println("[CREATE LAPORAN ERROR] Begin transaction:", err)
+		writeError(w, http.StatusInternalServerError, ErrCodeInternal, "Failed to create laporan")
+		return
+	}
+
+	if anonTokenHash != "" {
+		spent, err := spendAnonToken(tx, anonTokenHash)
+		if err == nil && !spent {
+			tx.Rollback()
+			log.Println("[CREATE LAPORAN ERROR] Anonim token already spent")
+			writeError(w, http.StatusConflict, ErrCodeAnonTokenSpent, "Anonim token was already used")
+			return
+		}
+		if err != nil {
+			tx.Rollback()
+			log.Println("[CREATE LAPORAN ERROR] Spend anonim token:", err)
+			writeError(w, http.StatusInternalServerError, ErrCodeInternal, "Failed to create laporan")
+			return
+		}
 	}
 
-	// Insert into database
 	var id int
-	err := db.QueryRow(
-		"INSERT INTO laporan (title, description, tipe, divisi, user_nik, status) VALUES ($1, $2, $3, $4, $5, $6) RETURNING id",
-		req.Title, req.Description, req.Tipe, req.Divisi, userIdentifier, "pending",
-	).Scan(&id)
+	if req.Tipe == "anonim" {
+		id, err = insertAnonimLaporan(tx, req, trackingCodeHash, lat, lng, accuracy)
+	} else {
+		err = tx.QueryRow(
+			`INSERT INTO laporan (title, description, tipe, divisi, user_nik, reporter_display, status, latitude, longitude, location_accuracy_m)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10) RETURNING id`,
+			req.Title, req.Description, req.Tipe, req.Divisi, userIdentifier, reporterDisplay, statusPending, lat, lng, accuracy,
+		).Scan(&id)
+	}
+
+	if err == nil && req.NotifyEmail != "" {
+		_, err = tx.Exec(`INSERT INTO laporan_anonim_contacts (laporan_id, email, locale) VALUES ($1, $2, $3)`,
+			id, req.NotifyEmail, req.NotifyLocale)
+	}
+
+	var attachments []Attachment
+	var storedKeys []string
+	if err == nil {
+		attachments, storedKeys, err = saveAttachments(r.Context(), tx, id, req.Tipe, uploads)
+	}
+	if err == nil {
+		err = tx.Commit()
+	} else {
+		tx.Rollback()
+	}
 
 	if err != nil {
 		log.Println("[CREATE LAPORAN ERROR] Database error:", err)
-		http.Error(w, "Failed to create laporan", http.StatusInternalServerError)
+		deleteStoredObjects(storedKeys)
+		writeError(w, http.StatusInternalServerError, ErrCodeInternal, "Failed to create laporan")
 		return
 	}
 
@@ -580,17 +1219,21 @@ func createLaporanHandler(w http.ResponseWriter, r *http.Request) {
 		Description: req.Description,
 		Tipe:        req.Tipe,
 		Divisi:      req.Divisi,
-		Status:      "pending",
-	}
+		Status:      statusPending,
+		Location:    location,
+		Attachments: attachments,
 
-	// Log success - hide NIK for anonim reports
-	if req.Tipe == "anonim" {
-		log.Printf("[CREATE LAPORAN SUCCESS] Created ANONIM laporan with ID: %d (identity protected)\n", id)
-	} else {
-		log.Printf("[CREATE LAPORAN SUCCESS] Created laporan with ID: %d by warga %s (%s)\n", id, userNama, userNIK)
+		DuplicateCandidates: duplicates,
+		TrackingCode:        trackingCode,
 	}
 
+	// Anonim reports only come in on the anonim path, so nothing about them is logged
+	logRequestf(r, "[CREATE LAPORAN SUCCESS] Created laporan with ID: %d by warga %s (%s)\n", id, userNama, userNIK)
+
 	w.Header().Set("Content-Type", "application/json")
+	if trackingCode != "" {
+		w.Header().Set("Cache-Control", "no-store")
+	}
 	w.WriteHeader(http.StatusCreated)
 	json.NewEncoder(w).Encode(laporan)
 }
@@ -0,0 +1,503 @@
+package main
+
+import (
+	"bytes"
+	"crypto/tls"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"mime"
+	"net"
+	"net/http"
+	"net/mail"
+	"net/smtp"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// Outbox templates, queued by database triggers (see notification_outbox in init.sql)
+const (
+	notifyReceived = "received" // the report was created
+	notifyStatus   = "status"   // an officer or the system changed its status
+	notifyReply    = "reply"    // an officer commented on it
+)
+
+const (
+	notifyBatchSize    = 10
+	notifyRetryBackoff = time.Minute // doubled after every failed attempt
+	// A claimed batch is sent outside any transaction; if the replica dies meanwhile,
+	// its rows become due again after this
+	notifyClaimTimeout = 10 * time.Minute
+	// Bounds a whole SMTP conversation, so a stalled server cannot hold up the worker
+	smtpTimeout = 30 * time.Second
+)
+
+var notifyLocales = map[string]bool{"id": true, "en": true}
+
+// Set from NOTIFY_POLL_INTERVAL, NOTIFY_MAX_ATTEMPTS and the SMTP_* variables
+var notifyPollInterval time.Duration
+var notifyMaxAttempts int
+var mailer mailSender
+
+// mailSender delivers one email. SMTP is used when SMTP_HOST is set; otherwise
+// emails are only logged, which is enough for local development.
+type mailSender interface {
+	Send(to, subject, body string) error
+}
+
+type smtpSender struct {
+	addr         string
+	from         string    // header value, e.g. "Laporan Warga <no-reply@laporan.local>"
+	envelopeFrom string    // bare address for MAIL FROM
+	auth         smtp.Auth // nil for servers without auth, such as a local mail catcher
+}
+
+func (s *smtpSender) Send(to, subject, body string) error {
+	var msg bytes.Buffer
+	fmt.Fprintf(&msg, "From: %s\r\n", s.from)
+	fmt.Fprintf(&msg, "To: %s\r\n", to)
+	fmt.Fprintf(&msg, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", subject))
+	fmt.Fprintf(&msg, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	msg.WriteString("MIME-Version: 1.0\r\n")
+	msg.WriteString("Content-Type: text/plain; charset=UTF-8\r\n")
+	msg.WriteString("Content-Transfer-Encoding: 8bit\r\n\r\n")
+	msg.WriteString(strings.ReplaceAll(body, "\n", "\r\n"))
+
+	// Same steps as smtp.SendMail, which has no timeouts of its own
+	conn, err := net.DialTimeout("tcp", s.addr, smtpTimeout)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	if err := conn.SetDeadline(time.Now().Add(smtpTimeout)); err != nil {
+		return err
+	}
+	host, _, _ := net.SplitHostPort(s.addr)
+	c, err := smtp.NewClient(conn, host)
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+	if ok, _ := c.Extension("STARTTLS"); ok {
+		if err := c.StartTLS(&tls.Config{ServerName: host}); err != nil {
+			return err
+		}
+	}
+	if s.auth != nil {
+		if ok, _ := c.Extension("AUTH"); !ok {
+			return errors.New("smtp: server does not support AUTH")
+		}
+		if err := c.Auth(s.auth); err != nil {
+			return err
+		}
+	}
+	if err := c.Mail(s.envelopeFrom); err != nil {
+		return err
+	}
+	if err := c.Rcpt(to); err != nil {
+		return err
+	}
+	w, err := c.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(msg.Bytes()); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	return c.Quit()
+}
+
+type logSender struct{}
+
+func (logSender) Send(to, subject, body string) error {
+	log.Printf("[NOTIFY] SMTP_HOST not set, email not sent: %q\n", subject)
+	return nil
+}
+
+func initNotifications() error {
+	var err error
+	notifyPollInterval, err = parseDuration(getEnv("NOTIFY_POLL_INTERVAL", "10s"))
+	if err != nil || notifyPollInterval <= 0 {
+		return fmt.Errorf("invalid NOTIFY_POLL_INTERVAL")
+	}
+	notifyMaxAttempts, err = strconv.Atoi(getEnv("NOTIFY_MAX_ATTEMPTS", "5"))
+	if err != nil || notifyMaxAttempts < 1 {
+		return fmt.Errorf("invalid NOTIFY_MAX_ATTEMPTS")
+	}
+
+	mailer = logSender{}
+	if host := getEnv("SMTP_HOST", ""); host != "" {
+		s := &smtpSender{
+			addr: net.JoinHostPort(host, getEnv("SMTP_PORT", "25")),
+			from: getEnv("SMTP_FROM", "Laporan Warga <no-reply@laporan.local>"),
+		}
+		from, err := mail.ParseAddress(s.from)
+		if err != nil {
+			return fmt.Errorf("invalid SMTP_FROM")
+		}
+		s.envelopeFrom = from.Address
+		if user := getEnv("SMTP_USERNAME", ""); user != "" {
+			s.auth = smtp.PlainAuth("", user, getEnv("SMTP_PASSWORD", ""), host)
+		}
+		mailer = s
+	}
+
+	go runNotificationWorker()
+	return nil
+}
+
+// emailTemplate is the subject and plain-text body of one email, per locale
+type emailTemplate struct {
+	Subject *template.Template
+	Body    *template.Template
+}
+
+func newEmailTemplate(subject, body string) emailTemplate {
+	return emailTemplate{
+		Subject: template.Must(template.New("subject").Parse(subject)),
+		Body:    template.Must(template.New("body").Parse(body)),
+	}
+}
+
+var emailTemplates = map[string]map[string]emailTemplate{
+	"id": {
+		notifyReceived: newEmailTemplate(`Laporan #{{.LaporanID}} diterima`,
+			"Laporan Anda \"{{.Title}}\" sudah kami terima dengan nomor #{{.LaporanID}}.\n\nKami akan mengabari Anda setiap kali statusnya berubah.\n"),
+		notifyStatus: newEmailTemplate(`Status laporan #{{.LaporanID}}: {{.ToStatus}}`,
+			"Status laporan Anda \"{{.Title}}\" berubah dari {{.FromStatus}} menjadi {{.ToStatus}}.\n{{if .Note}}\nCatatan petugas: {{.Note}}\n{{end}}"),
+		notifyReply: newEmailTemplate(`Balasan petugas pada laporan #{{.LaporanID}}`,
+			"{{.AuthorName}} membalas laporan Anda \"{{.Title}}\":\n\n{{.Body}}\n"),
+	},
+	"en": {
+		notifyReceived: newEmailTemplate(`Report #{{.LaporanID}} received`,
+			"We have received your report \"{{.Title}}\" as #{{.LaporanID}}.\n\nWe will let you know whenever its status changes.\n"),
+		notifyStatus: newEmailTemplate(`Report #{{.LaporanID}} is now {{.ToStatus}}`,
+			"The status of your report \"{{.Title}}\" changed from {{.FromStatus}} to {{.ToStatus}}.\n{{if .Note}}\nOfficer's note: {{.Note}}\n{{end}}"),
+		notifyReply: newEmailTemplate(`An officer replied to report #{{.LaporanID}}`,
+			"{{.AuthorName}} replied to your report \"{{.Title}}\":\n\n{{.Body}}\n"),
+	},
+}
+
+var statusLabels = map[string]map[string]string{
+	"id": {statusPending: "Menunggu", statusVerified: "Terverifikasi", statusDiproses: "Diproses",
+		statusSelesai: "Selesai", statusDitolak: "Ditolak", statusWithdrawn: "Ditarik"},
+	"en": {statusPending: "Pending", statusVerified: "Verified", statusDiproses: "In progress",
+		statusSelesai: "Resolved", statusDitolak: "Rejected", statusWithdrawn: "Withdrawn"},
+}
+
+// emailData is what the templates can use; the outbox row's JSON data fills it in
+type emailData struct {
+	LaporanID  int    `json:"laporan_id"`
+	Title      string `json:"-"`
+	FromStatus string `json:"from_status"`
+	ToStatus   string `json:"to_status"`
+	Note       string `json:"note"`
+	AuthorName string `json:"author_name"`
+	Body       string `json:"body"`
+}
+
+func renderEmail(locale, name string, data emailData) (subject, body string, err error) {
+	tmpl, ok := emailTemplates[locale][name]
+	if !ok {
+		return "", "", fmt.Errorf("no %s template for locale %s", name, locale)
+	}
+	if label, ok := statusLabels[locale][data.FromStatus]; ok {
+		data.FromStatus = label
+	}
+	if label, ok := statusLabels[locale][data.ToStatus]; ok {
+		data.ToStatus = label
+	}
+	var s, b bytes.Buffer
+	if err := tmpl.Subject.Execute(&s, data); err != nil {
+		return "", "", err
+	}
+	if err := tmpl.Body.Execute(&b, data); err != nil {
+		return "", "", err
+	}
+	return s.String(), b.String(), nil
+}
+
+// NotificationPreferences are a warga's email settings for their own reports
+type NotificationPreferences struct {
+	EmailEnabled  bool   `json:"email_enabled"`
+	Locale        string `json:"locale"` // id or en
+	Received      bool   `json:"received"`
+	StatusChanges bool   `json:"status_changes"`
+	Replies       bool   `json:"replies"`
+}
+
+var defaultNotificationPreferences = NotificationPreferences{
+	EmailEnabled: true, Locale: "id", Received: true, StatusChanges: true, Replies: true,
+}
+
+func loadNotificationPreferences(q interface {
+	QueryRow(string, ...interface{}) *sql.Row
+}, nik string) (NotificationPreferences, error) {
+	p := defaultNotificationPreferences
+	err := q.QueryRow(`
+		SELECT email_enabled, locale, on_received, on_status, on_reply
+		FROM notification_preferences WHERE user_nik = $1
+	`, nik).Scan(&p.EmailEnabled, &p.Locale, &p.Received, &p.StatusChanges, &p.Replies)
+	if errors.Is(err, sql.ErrNoRows) {
+		err = nil
+	}
+	return p, err
+}
+
+func (p NotificationPreferences) wants(name string) bool {
+	switch name {
+	case notifyReceived:
+		return p.EmailEnabled && p.Received
+	case notifyStatus:
+		return p.EmailEnabled && p.StatusChanges
+	case notifyReply:
+		return p.EmailEnabled && p.Replies
+	}
+	return false
+}
+
+// GET /laporan/my/notifications - The caller's email preferences
+// PUT /laporan/my/notifications - Change them; fields left out keep their value
+func notificationPreferencesHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodPut {
+		writeMethodNotAllowed(w)
+		return
+	}
+	userNik := r.Header.Get("X-User-NIK")
+
+	prefs, err := loadNotificationPreferences(db, userNik)
+	if err != nil {
+		log.Println("[NOTIFICATION PREFERENCES ERROR] Database error:", err)
+		writeError(w, http.StatusInternalServerError, ErrCodeInternal, "Failed to load notification preferences")
+		return
+	}
+
+	if r.Method == http.MethodPut {
+		if err := json.NewDecoder(r.Body).Decode(&prefs); err != nil {
+			writeError(w, http.StatusBadRequest, ErrCodeInvalidRequestBody, "Invalid request body")
+			return
+		}
+		if !notifyLocales[prefs.Locale] {
+			writeFieldError(w, http.StatusBadRequest, ErrCodeValidationFailed, "Locale must be one of: id, en", map[string]string{"locale": "must be one of: id, en"})
+			return
+		}
+		_, err := db.Exec(`
+			INSERT INTO notification_preferences (user_nik, email_enabled, locale, on_received, on_status, on_reply)
+			VALUES ($1, $2, $3, $4, $5, $6)
+			ON CONFLICT (user_nik) DO UPDATE SET
+				email_enabled = EXCLUDED.email_enabled, locale = EXCLUDED.locale, on_received = EXCLUDED.on_received,
+				on_status = EXCLUDED.on_status, on_reply = EXCLUDED.on_reply, updated_at = CURRENT_TIMESTAMP
+		`, userNik, prefs.EmailEnabled, prefs.Locale, prefs.Received, prefs.StatusChanges, prefs.Replies)
+		if err != nil {
+			log.Println("[NOTIFICATION PREFERENCES ERROR] Database error:", err)
+			writeError(w, http.StatusInternalServerError, ErrCodeInternal, "Failed to save notification preferences")
+			return
+		}
+		log.Printf("[NOTIFICATION PREFERENCES SUCCESS] Updated for warga %s\n", userNik)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(prefs)
+}
+
+// validateNotifyEmail checks the optional throwaway contact of an anonim report
+func validateNotifyEmail(email, locale string) map[string]string {
+	fields := map[string]string{}
+	if email == "" {
+		if locale != "" {
+			fields["notifyLocale"] = "requires notifyEmail"
+		}
+		return fields
+	}
+	if addr, err := mail.ParseAddress(email); err != nil || addr.Address != email || len(email) > 255 {
+		fields["notifyEmail"] = "must be a plain email address"
+	}
+	if locale != "" && !notifyLocales[locale] {
+		fields["notifyLocale"] = "must be one of: id, en"
+	}
+	return fields
+}
+
+func runNotificationWorker() {
+	for {
+		n, err := deliverDueNotifications()
+		if err != nil {
+			log.Println("[NOTIFY ERROR] Delivery round failed:", err)
+		}
+		// A full batch means more may be waiting
+		if err != nil || n < notifyBatchSize {
+			time.Sleep(notifyPollInterval)
+		}
+	}
+}
+
+type outboxItem struct {
+	ID        int64
+	LaporanID int
+	Template  string
+	Data      []byte
+	Attempts  int
+	Tipe      string
+	UserNik   sql.NullString
+	Title     string
+}
+
+// deliverDueNotifications sends one batch of due outbox rows. SKIP LOCKED lets every
+// replica claim rows without two of them sending the same email. Rows are claimed in a
+// short transaction and sent after it commits, so a slow mail server never holds
+// row locks or leaves a connection idle in a transaction.
+func deliverDueNotifications() (int, error) {
+	items, err := claimDueNotifications()
+	if err != nil {
+		return 0, err
+	}
+	for _, it := range items {
+		status, sendErr := deliverNotification(it)
+		if err := recordNotificationResult(it, status, sendErr); err != nil {
+			return 0, err
+		}
+	}
+	return len(items), nil
+}
+
+// claimDueNotifications takes up to notifyBatchSize due rows and pushes their
+// next_attempt_at past notifyClaimTimeout, so no other replica picks them up meanwhile
+func claimDueNotifications() ([]outboxItem, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.Query(`
+		SELECT o.id, o.laporan_id, o.template, o.data, o.attempts, l.tipe, l.user_nik, l.title
+		FROM notification_outbox o
+		JOIN laporan l ON l.id = o.laporan_id
+		WHERE o.status = 'pending' AND o.next_attempt_at <= CURRENT_TIMESTAMP
+		ORDER BY o.id
+		LIMIT $1
+		FOR UPDATE OF o SKIP LOCKED
+	`, notifyBatchSize)
+	if err != nil {
+		return nil, err
+	}
+	var items []outboxItem
+	var ids []int64
+	for rows.Next() {
+		var it outboxItem
+		if err := rows.Scan(&it.ID, &it.LaporanID, &it.Template, &it.Data, &it.Attempts, &it.Tipe, &it.UserNik, &it.Title); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		items = append(items, it)
+		ids = append(ids, it.ID)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if len(items) == 0 {
+		return nil, nil
+	}
+
+	if _, err := tx.Exec(`
+		UPDATE notification_outbox
+		SET next_attempt_at = CURRENT_TIMESTAMP + $2::double precision * INTERVAL '1 second'
+		WHERE id = ANY($1)
+	`, pq.Array(ids), notifyClaimTimeout.Seconds()); err != nil {
+		return nil, err
+	}
+	return items, tx.Commit()
+}
+
+// recordNotificationResult stores the outcome of one delivery attempt
+func recordNotificationResult(it outboxItem, status string, sendErr error) error {
+	var err error
+	if it.Tipe == "anonim" && (sendErr == nil || it.Attempts+1 >= notifyMaxAttempts) {
+		// A finished row would keep an exact sent_at for the report, so it goes instead
+		if sendErr != nil {
+			log.Printf("[NOTIFY ERROR] Giving up on notification %d: %v\n", it.ID, sendErr)
+		}
+		_, err = db.Exec(`DELETE FROM notification_outbox WHERE id = $1`, it.ID)
+	} else if sendErr == nil {
+		_, err = db.Exec(`UPDATE notification_outbox SET status = $2, attempts = attempts + 1, sent_at = CURRENT_TIMESTAMP, last_error = NULL WHERE id = $1`,
+			it.ID, status)
+	} else if it.Attempts+1 >= notifyMaxAttempts {
+		log.Printf("[NOTIFY ERROR] Giving up on notification %d: %v\n", it.ID, sendErr)
+		_, err = db.Exec(`UPDATE notification_outbox SET status = 'failed', attempts = attempts + 1, last_error = $2 WHERE id = $1`,
+			it.ID, sendErr.Error())
+	} else {
+		log.Printf("[NOTIFY ERROR] Notification %d failed, will retry: %v\n", it.ID, sendErr)
+		_, err = db.Exec(`
+			UPDATE notification_outbox
+			SET attempts = attempts + 1, last_error = $2,
+			    next_attempt_at = CURRENT_TIMESTAMP + $3::double precision * INTERVAL '1 second'
+			WHERE id = $1
+		`, it.ID, sendErr.Error(), (notifyRetryBackoff << it.Attempts).Seconds())
+	}
+	return err
+}
+
+// deliverNotification resolves the recipient and sends the email. It returns "sent",
+// or "skipped" when there is nobody to tell or they opted out. Anonim reports only
+// ever go to the throwaway contact given with the report; the reporter's account
+// email is never looked up for them.
+func deliverNotification(it outboxItem) (string, error) {
+	var to, locale string
+	if it.Tipe == "anonim" {
+		err := db.QueryRow(`SELECT email, locale FROM laporan_anonim_contacts WHERE laporan_id = $1`, it.LaporanID).Scan(&to, &locale)
+		if errors.Is(err, sql.ErrNoRows) {
+			return "skipped", nil
+		}
+		if err != nil {
+			return "", err
+		}
+	} else {
+		if !it.UserNik.Valid {
+			return "skipped", nil
+		}
+		prefs, err := loadNotificationPreferences(db, it.UserNik.String)
+		if err != nil {
+			return "", err
+		}
+		if !prefs.wants(it.Template) {
+			return "skipped", nil
+		}
+		err = authDB.QueryRow(`SELECT email FROM users WHERE nik = $1`, it.UserNik.String).Scan(&to)
+		if errors.Is(err, sql.ErrNoRows) {
+			return "skipped", nil
+		}
+		if err != nil {
+			return "", err
+		}
+		locale = prefs.Locale
+	}
+
+	data := emailData{LaporanID: it.LaporanID}
+	if err := json.Unmarshal(it.Data, &data); err != nil {
+		return "", err
+	}
+	data.Title = it.Title
+	subject, body, err := renderEmail(locale, it.Template, data)
+	if err != nil {
+		return "", err
+	}
+	if err := mailer.Send(to, subject, body); err != nil {
+		return "", err
+	}
+	if it.Tipe == "anonim" {
+		log.Printf("[NOTIFY SUCCESS] Sent %s notification for an anonim laporan\n", it.Template)
+	} else {
+		log.Printf("[NOTIFY SUCCESS] Sent %s notification for laporan %d\n", it.Template, it.LaporanID)
+	}
+	return "sent", nil
+}
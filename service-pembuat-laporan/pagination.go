@@ -0,0 +1,156 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+// keysetOrder describes a sort that supports cursor pagination: rows are ordered
+// by (Column, id) and the cursor remembers both values of the boundary row
+type keysetOrder struct {
+	Column string
+	Desc   bool
+}
+
+// Sorts usable with ?cursor= (relevance and distance have no stable key)
+var keysetOrders = map[string]keysetOrder{
+	"newest":  {Column: "created_at", Desc: true},
+	"oldest":  {Column: "created_at", Desc: false},
+	"updated": {Column: "updated_at", Desc: true},
+}
+
+// pageCursor is the decoded form of the opaque next/prev cursor
+type pageCursor struct {
+	Sort   string    `json:"s"`
+	Time   time.Time `json:"t"`
+	ID     int       `json:"i"`
+	Before bool      `json:"b,omitempty"` // true for prev cursors
+}
+
+func encodeCursor(c pageCursor) string {
+	b, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// decodeCursor parses a cursor and checks it was issued for the same sort
+func decodeCursor(s, sort string) (pageCursor, error) {
+	var c pageCursor
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return c, err
+	}
+	if err := json.Unmarshal(b, &c); err != nil {
+		return c, err
+	}
+	if c.Sort != sort || c.ID <= 0 || c.Time.IsZero() {
+		return c, fmt.Errorf("cursor does not match sort %q", sort)
+	}
+	return c, nil
+}
+
+// where returns the keyset condition for rows after (or, for prev cursors, before) c
+func (o keysetOrder) where(c pageCursor, arg func(interface{}) string) string {
+	op := ">"
+	if o.Desc != c.Before {
+		op = "<"
+	}
+	return "(" + o.Column + ", id) " + op + " (" + arg(c.Time) + ", " + arg(c.ID) + ")"
+}
+
+// orderBy returns the ORDER BY clause; prev pages are read backwards and reversed afterwards
+func (o keysetOrder) orderBy(before bool) string {
+	dir := "ASC"
+	if o.Desc != before {
+		dir = "DESC"
+	}
+	return o.Column + " " + dir + ", id " + dir
+}
+
+// key returns the cursor time for a row under this order
+func (o keysetOrder) key(l PublicLaporan) time.Time {
+	if o.Column == "updated_at" {
+		return l.UpdatedAt
+	}
+	return l.CreatedAt
+}
+
+// Totals and per-status stats for a filter are cached briefly: they need a full
+// scan of the filtered set, and the dashboard refetches them on every page.
+var statsCacheTTL time.Duration
+
+const statsCacheMaxEntries = 1000
+
+type cachedTotals struct {
+	Total   int
+	Stats   StatusStats
+	Expires time.Time
+}
+
+var statsCache = struct {
+	sync.Mutex
+	entries map[string]cachedTotals
+}{entries: map[string]cachedTotals{}}
+
+// publicTotals returns the row count and status stats for where/args
+func publicTotals(where string, args []interface{}) (int, StatusStats, error) {
+	key := where + "\x00" + fmt.Sprint(args...)
+	now := time.Now()
+
+	statsCache.Lock()
+	cached, ok := statsCache.entries[key]
+	statsCache.Unlock()
+	if ok && now.Before(cached.Expires) {
+		return cached.Total, cached.Stats, nil
+	}
+
+	var total int
+	var stats StatusStats
+	rows, err := db.Query(`SELECT status, COUNT(*) FROM laporan WHERE `+where+` GROUP BY status`, args...)
+	if err != nil {
+		return 0, stats, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var status string
+		var count int
+		if err := rows.Scan(&status, &count); err != nil {
+			return 0, stats, err
+		}
+		stats.add(status, count)
+		total += count
+	}
+	if err := rows.Err(); err != nil {
+		return 0, stats, err
+	}
+
+	if statsCacheTTL > 0 {
+		statsCache.Lock()
+		if len(statsCache.entries) >= statsCacheMaxEntries {
+			for k, e := range statsCache.entries {
+				if now.After(e.Expires) {
+					delete(statsCache.entries, k)
+				}
+			}
+			if len(statsCache.entries) >= statsCacheMaxEntries {
+				statsCache.entries = map[string]cachedTotals{}
+			}
+		}
+		statsCache.entries[key] = cachedTotals{Total: total, Stats: stats, Expires: now.Add(statsCacheTTL)}
+		statsCache.Unlock()
+	}
+	return total, stats, nil
+}
+
+// wantTotals reports whether a cursor request asked for totals (?include=totals)
+func wantTotals(include string) bool {
+	for _, v := range strings.Split(include, ",") {
+		if strings.TrimSpace(v) == "totals" {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,164 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/gorilla/websocket"
+)
+
+// Real-looking NIKs: 16 digits, as stored in laporan.user_nik, laporan_supports and
+// laporan_comments.author_id
+const (
+	testNIKReporter  = "3171011505900001"
+	testNIKPrivate   = "3273022208850002"
+	testNIKSupporter = "3578031012920003"
+	testNIKCommenter = "3374041703880004"
+)
+
+var nikPattern = regexp.MustCompile(`[0-9]{16}`)
+
+// assertNoNIK fails when a public response carries anything NIK-shaped
+func assertNoNIK(t *testing.T, body string) {
+	t.Helper()
+	if m := nikPattern.FindString(body); m != "" {
+		t.Errorf("response contains NIK-shaped value %q:\n%s", m, body)
+	}
+	if strings.Contains(body, "user_nik") {
+		t.Errorf("response contains user_nik:\n%s", body)
+	}
+}
+
+func testWargaToken(t *testing.T, nik string) string {
+	t.Helper()
+	token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, Claims{
+		UserID: 1, NIK: nik, Nama: "Budi Santoso", Role: "warga",
+		RegisteredClaims: jwt.RegisteredClaims{ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Hour))},
+	}).SignedString(jwtSecret)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return token
+}
+
+// seedNIKReports creates a publik report with a location, a supporter, a public
+// comment thread and a status change, plus a private and an anonim report
+func seedNIKReports(t *testing.T) (publikID, privateID int) {
+	t.Helper()
+	err := db.QueryRow(`
+		INSERT INTO laporan (title, description, tipe, divisi, user_nik, reporter_display, latitude, longitude, location_accuracy_m)
+		VALUES ('Jalan berlubang di depan sekolah', 'Lubang besar membahayakan pengendara motor', 'publik', 'fasilitas umum', $1, 'Budi S.', -6.2, 106.8, 10)
+		RETURNING id
+	`, testNIKReporter).Scan(&publikID)
+	if err != nil {
+		t.Fatal("seed publik:", err)
+	}
+	err = db.QueryRow(`
+		INSERT INTO laporan (title, description, tipe, divisi, user_nik, latitude, longitude)
+		VALUES ('Sampah menumpuk di gang', 'Sampah tidak diangkut seminggu', 'private', 'kebersihan', $1, -6.2001, 106.8001)
+		RETURNING id
+	`, testNIKPrivate).Scan(&privateID)
+	if err != nil {
+		t.Fatal("seed private:", err)
+	}
+	statements := []struct {
+		query string
+		args  []interface{}
+	}{
+		{`INSERT INTO laporan (id, title, description, tipe, divisi, tracking_code_hash, latitude, longitude)
+		  VALUES (1500000000, 'Pungutan liar di pasar', 'Oknum meminta uang keamanan', 'anonim', 'kriminalitas', $1, -6.2002, 106.8002)`,
+			[]interface{}{strings.Repeat("ab", 32)}},
+		{`INSERT INTO laporan_supports (laporan_id, voter_nik) VALUES ($1, $2)`, []interface{}{publikID, testNIKSupporter}},
+		{`UPDATE laporan SET support_count = 1 WHERE id = $1`, []interface{}{publikID}},
+		{`UPDATE laporan SET status = 'verified' WHERE id = $1`, []interface{}{publikID}},
+		{`INSERT INTO laporan_comments (laporan_id, visibility, author_type, author_id, author_display, body)
+		  VALUES ($1, 'public', 'warga', $2, 'Siti A.', 'Saya juga melihat lubang ini')`, []interface{}{publikID, testNIKCommenter}},
+		{`INSERT INTO laporan_comments (laporan_id, parent_id, visibility, author_type, author_id, author_display, body)
+		  SELECT $1, id, 'public', 'reporter', $2, 'Pelapor', 'Terima kasih' FROM laporan_comments WHERE laporan_id = $1`,
+			[]interface{}{publikID, testNIKReporter}},
+	}
+	for _, s := range statements {
+		if _, err := db.Exec(s.query, s.args...); err != nil {
+			t.Fatal("seed:", err)
+		}
+	}
+	return publikID, privateID
+}
+
+func TestPublicResponsesNeverContainNIK(t *testing.T) {
+	openTestDB(t)
+	jwtSecret = []byte("test-secret")
+	publikID, privateID := seedNIKReports(t)
+
+	publicList := optionalAuthMiddleware(getPublicLaporanHandler)
+	cases := []struct {
+		name    string
+		handler http.HandlerFunc
+		path    string
+		nik     string // caller's token, empty for an anonymous caller
+		want    string // must appear, so an empty result cannot pass
+	}{
+		{"public list", publicList, "/laporan/public", "", "Jalan berlubang"},
+		{"public list as reporter", publicList, "/laporan/public", testNIKReporter, "Jalan berlubang"},
+		{"public list as supporter", publicList, "/laporan/public", testNIKSupporter, "Jalan berlubang"},
+		{"cursor page", publicList, "/laporan/public?cursor=&include=totals", "", "Jalan berlubang"},
+		{"search", publicList, "/laporan/public?q=berlubang", "", "berlubang"},
+		{"geojson", publicList, "/laporan/public?format=geojson", "", "Jalan berlubang"},
+		{"nearby", publicList, "/laporan/public?near=-6.2,106.8&radius=1000", "", "Jalan berlubang"},
+		{"detail", laporanItemRouter, fmt.Sprintf("/laporan/%d", publikID), "", "Jalan berlubang"},
+		{"detail as reporter", laporanItemRouter, fmt.Sprintf("/laporan/%d", publikID), testNIKReporter, "Jalan berlubang"},
+		{"own private detail", laporanItemRouter, fmt.Sprintf("/laporan/%d", privateID), testNIKPrivate, "Sampah menumpuk"},
+		{"comments", laporanItemRouter, fmt.Sprintf("/laporan/%d/comments", publikID), "", "Siti A."},
+		{"comments as commenter", laporanItemRouter, fmt.Sprintf("/laporan/%d/comments", publikID), testNIKCommenter, "Siti A."},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, tc.path, nil)
+			if tc.nik != "" {
+				req.Header.Set("Authorization", "Bearer "+testWargaToken(t, tc.nik))
+			}
+			rec := httptest.NewRecorder()
+			tc.handler(rec, req)
+			body := rec.Body.String()
+			if rec.Code != http.StatusOK {
+				t.Fatalf("status %d: %s", rec.Code, body)
+			}
+			if !strings.Contains(body, tc.want) {
+				t.Fatalf("response does not contain %q: %s", tc.want, body)
+			}
+			assertNoNIK(t, body)
+		})
+	}
+
+	t.Run("live feed", func(t *testing.T) {
+		server := httptest.NewServer(http.HandlerFunc(publicLiveFeedHandler))
+		defer server.Close()
+		conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(server.URL, "http")+"/laporan/public/live", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer conn.Close()
+		for deadline := time.Now().Add(2 * time.Second); liveFeed.empty(); time.Sleep(10 * time.Millisecond) {
+			if time.Now().After(deadline) {
+				t.Fatal("client never joined the live feed")
+			}
+		}
+
+		liveFeed.publish("created", publikID)
+		conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+		_, msg, err := conn.ReadMessage()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !strings.Contains(string(msg), "Jalan berlubang") {
+			t.Fatalf("unexpected message: %s", msg)
+		}
+		assertNoNIK(t, string(msg))
+	})
+}
@@ -0,0 +1,510 @@
+package main
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ecdh"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"math/big"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/lib/pq"
+	"golang.org/x/crypto/hkdf"
+)
+
+const (
+	pushRecordSize   = 4096 // RFC 8188 record size; payloads must fit in one record
+	maxPushPayload   = pushRecordSize - 16 - 1 - 86
+	pushTTLSeconds   = 86400
+	pushVAPIDExpiry  = 12 * time.Hour
+	pushBatchSize    = 20
+	maxPushEndpoint  = 1000
+	pushRequestLimit = 10 * time.Second
+)
+
+// Set from VAPID_PUBLIC_KEY, VAPID_PRIVATE_KEY, VAPID_SUBJECT and
+// PUSH_ALLOW_INSECURE_ENDPOINTS. Push is disabled when the keys are not set.
+var vapidPrivateKey *ecdsa.PrivateKey
+var vapidPublicKey string // base64url uncompressed P-256 point, as browsers expect
+var vapidSubject string
+var pushAllowInsecure bool
+
+// pushClient only connects to public addresses and never follows redirects, so a
+// subscription cannot point the worker at anything inside the cluster
+var pushClient = &http.Client{
+	Timeout: pushRequestLimit,
+	Transport: &http.Transport{
+		Proxy:               http.ProxyFromEnvironment,
+		DialContext:         (&net.Dialer{Timeout: pushRequestLimit, Control: pushDialControl}).DialContext,
+		TLSHandshakeTimeout: pushRequestLimit,
+		MaxIdleConnsPerHost: 4,
+		IdleConnTimeout:     90 * time.Second,
+	},
+	CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse },
+}
+
+var errPushAddressNotAllowed = errors.New("push endpoint resolves to a non-public address")
+
+// Shared address space (RFC 6598), used by some clusters for pod and service ranges
+var carrierGradeNAT = &net.IPNet{IP: net.IPv4(100, 64, 0, 0), Mask: net.CIDRMask(10, 32)}
+
+// isPublicIP rejects loopback, private, link-local and other non-routable addresses
+func isPublicIP(ip net.IP) bool {
+	return !(ip.IsLoopback() || ip.IsPrivate() || ip.IsUnspecified() || ip.IsMulticast() ||
+		ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() || carrierGradeNAT.Contains(ip))
+}
+
+// pushDialControl checks the resolved address right before connecting, which also
+// covers public names that resolve to internal addresses
+func pushDialControl(network, address string, _ syscall.RawConn) error {
+	if pushAllowInsecure {
+		return nil
+	}
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	if ip := net.ParseIP(host); ip == nil || !isPublicIP(ip) {
+		return errPushAddressNotAllowed
+	}
+	return nil
+}
+
+// isPublicPushHost accepts DNS names of public push services. IP literals, localhost,
+// single-label names and cluster-local names (*.svc, *.cluster.local) are refused.
+func isPublicPushHost(host string) bool {
+	host = strings.TrimSuffix(strings.ToLower(host), ".")
+	if host == "" || net.ParseIP(host) != nil || !strings.Contains(host, ".") {
+		return false
+	}
+	for _, suffix := range []string{".localhost", ".local", ".internal", ".svc", ".cluster.local"} {
+		if strings.HasSuffix(host, suffix) {
+			return false
+		}
+	}
+	return true
+}
+
+// pushWake is signalled when new laporan_events may be waiting to be pushed
+var pushWake = make(chan struct{}, 1)
+
+func initPush() error {
+	pub, priv := getEnv("VAPID_PUBLIC_KEY", ""), getEnv("VAPID_PRIVATE_KEY", "")
+	if pub == "" && priv == "" {
+		log.Println("[PUSH] VAPID keys not set, Web Push disabled")
+		return nil
+	}
+	d, err := base64.RawURLEncoding.DecodeString(priv)
+	if err != nil {
+		return fmt.Errorf("invalid VAPID_PRIVATE_KEY")
+	}
+	key, err := ecdh.P256().NewPrivateKey(d)
+	if err != nil {
+		return fmt.Errorf("invalid VAPID_PRIVATE_KEY")
+	}
+	point := key.PublicKey().Bytes()
+	if base64.RawURLEncoding.EncodeToString(point) != pub {
+		return fmt.Errorf("VAPID_PUBLIC_KEY does not match VAPID_PRIVATE_KEY")
+	}
+	vapidPrivateKey = &ecdsa.PrivateKey{
+		PublicKey: ecdsa.PublicKey{Curve: elliptic.P256(), X: new(big.Int).SetBytes(point[1:33]), Y: new(big.Int).SetBytes(point[33:])},
+		D:         new(big.Int).SetBytes(d),
+	}
+	vapidPublicKey = pub
+	vapidSubject = getEnv("VAPID_SUBJECT", "mailto:admin@laporan.local")
+	pushAllowInsecure = getEnv("PUSH_ALLOW_INSECURE_ENDPOINTS", "false") == "true"
+
+	go runPushWorker()
+	return nil
+}
+
+// PushSubscription is the browser's PushSubscription.toJSON()
+type PushSubscription struct {
+	Endpoint string `json:"endpoint"`
+	Keys     struct {
+		P256dh string `json:"p256dh"`
+		Auth   string `json:"auth"`
+	} `json:"keys"`
+}
+
+// validate checks the endpoint URL and that the keys decode to a P-256 point and a
+// 16-byte auth secret. Only https endpoints on public hosts are accepted unless
+// insecure ones are allowed.
+func (s *PushSubscription) validate() map[string]string {
+	fields := map[string]string{}
+	u, err := url.Parse(s.Endpoint)
+	if err != nil || u.Host == "" || len(s.Endpoint) > maxPushEndpoint ||
+		!(u.Scheme == "https" || (pushAllowInsecure && u.Scheme == "http")) {
+		fields["endpoint"] = "must be an https URL"
+	} else if !pushAllowInsecure && !isPublicPushHost(u.Hostname()) {
+		fields["endpoint"] = "must be on a public push service host"
+	}
+	if p, err := base64.RawURLEncoding.DecodeString(s.Keys.P256dh); err != nil {
+		fields["keys.p256dh"] = "must be a base64url P-256 public key"
+	} else if _, err := ecdh.P256().NewPublicKey(p); err != nil {
+		fields["keys.p256dh"] = "must be a base64url P-256 public key"
+	}
+	if a, err := base64.RawURLEncoding.DecodeString(s.Keys.Auth); err != nil || len(a) != 16 {
+		fields["keys.auth"] = "must be a base64url 16-byte secret"
+	}
+	return fields
+}
+
+// GET /laporan/push/key - The VAPID public key for PushManager.subscribe()
+func pushKeyHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeMethodNotAllowed(w)
+		return
+	}
+	if vapidPrivateKey == nil {
+		writeError(w, http.StatusServiceUnavailable, ErrCodePushDisabled, "Web Push is not configured")
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"publicKey": vapidPublicKey})
+}
+
+// POST /laporan/push/subscriptions - Store the caller's browser subscription (idempotent)
+// DELETE /laporan/push/subscriptions - Remove it; the body carries at least the endpoint
+func pushSubscriptionsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost && r.Method != http.MethodDelete {
+		writeMethodNotAllowed(w)
+		return
+	}
+	if vapidPrivateKey == nil {
+		writeError(w, http.StatusServiceUnavailable, ErrCodePushDisabled, "Web Push is not configured")
+		return
+	}
+	userNik := r.Header.Get("X-User-NIK")
+
+	var sub PushSubscription
+	if err := json.NewDecoder(r.Body).Decode(&sub); err != nil {
+		writeError(w, http.StatusBadRequest, ErrCodeInvalidRequestBody, "Invalid request body")
+		return
+	}
+
+	if r.Method == http.MethodDelete {
+		if _, err := db.Exec(`DELETE FROM push_subscriptions WHERE endpoint = $1 AND user_nik = $2`, sub.Endpoint, userNik); err != nil {
+			log.Println("[PUSH UNSUBSCRIBE ERROR] Database error:", err)
+			writeError(w, http.StatusInternalServerError, ErrCodeInternal, "Failed to remove push subscription")
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	if fields := sub.validate(); len(fields) > 0 {
+		writeFieldError(w, http.StatusBadRequest, ErrCodeValidationFailed, "Invalid push subscription", fields)
+		return
+	}
+	// An endpoint belongs to one browser; re-subscribing moves it to the current user
+	_, err := db.Exec(`
+		INSERT INTO push_subscriptions (user_nik, endpoint, p256dh, auth)
+		VALUES ($1, $2, $3, $4)
+		ON CONFLICT (endpoint) DO UPDATE SET user_nik = EXCLUDED.user_nik, p256dh = EXCLUDED.p256dh, auth = EXCLUDED.auth
+	`, userNik, sub.Endpoint, sub.Keys.P256dh, sub.Keys.Auth)
+	if err != nil {
+		log.Println("[PUSH SUBSCRIBE ERROR] Database error:", err)
+		writeError(w, http.StatusInternalServerError, ErrCodeInternal, "Failed to save push subscription")
+		return
+	}
+	log.Printf("[PUSH SUBSCRIBE SUCCESS] Subscription stored for warga %s\n", userNik)
+	w.WriteHeader(http.StatusCreated)
+}
+
+// encryptPushPayload encrypts plaintext for one subscription as a single
+// aes128gcm record (RFC 8291 key derivation, RFC 8188 framing)
+func encryptPushPayload(sub *PushSubscription, plaintext []byte) ([]byte, error) {
+	uaPublicBytes, err := base64.RawURLEncoding.DecodeString(sub.Keys.P256dh)
+	if err != nil {
+		return nil, err
+	}
+	authSecret, err := base64.RawURLEncoding.DecodeString(sub.Keys.Auth)
+	if err != nil {
+		return nil, err
+	}
+	uaPublic, err := ecdh.P256().NewPublicKey(uaPublicBytes)
+	if err != nil {
+		return nil, err
+	}
+	asPrivate, err := ecdh.P256().GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	asPublicBytes := asPrivate.PublicKey().Bytes()
+	shared, err := asPrivate.ECDH(uaPublic)
+	if err != nil {
+		return nil, err
+	}
+
+	keyInfo := append(append([]byte("WebPush: info\x00"), uaPublicBytes...), asPublicBytes...)
+	ikm := make([]byte, 32)
+	if _, err := io.ReadFull(hkdf.New(sha256.New, shared, authSecret, keyInfo), ikm); err != nil {
+		return nil, err
+	}
+	salt := make([]byte, 16)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, err
+	}
+	cek := make([]byte, 16)
+	if _, err := io.ReadFull(hkdf.New(sha256.New, ikm, salt, []byte("Content-Encoding: aes128gcm\x00")), cek); err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, 12)
+	if _, err := io.ReadFull(hkdf.New(sha256.New, ikm, salt, []byte("Content-Encoding: nonce\x00")), nonce); err != nil {
+		return nil, err
+	}
+
+	block, err := aes.NewCipher(cek)
+	if err != nil {
+		return nil, err
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	// 0x02 marks the last (and only) record
+	record := gcm.Seal(nil, nonce, append(plaintext, 0x02), nil)
+
+	var body bytes.Buffer
+	body.Write(salt)
+	binary.Write(&body, binary.BigEndian, uint32(pushRecordSize))
+	body.WriteByte(byte(len(asPublicBytes)))
+	body.Write(asPublicBytes)
+	body.Write(record)
+	return body.Bytes(), nil
+}
+
+// vapidAuthorization builds the RFC 8292 header for the push service at endpoint
+func vapidAuthorization(endpoint string) (string, error) {
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return "", err
+	}
+	token, err := jwt.NewWithClaims(jwt.SigningMethodES256, jwt.RegisteredClaims{
+		Audience:  jwt.ClaimStrings{u.Scheme + "://" + u.Host},
+		ExpiresAt: jwt.NewNumericDate(time.Now().Add(pushVAPIDExpiry)),
+		Subject:   vapidSubject,
+	}).SignedString(vapidPrivateKey)
+	if err != nil {
+		return "", err
+	}
+	return "vapid t=" + token + ", k=" + vapidPublicKey, nil
+}
+
+// errPushGone means the push service no longer knows the subscription (404/410)
+var errPushGone = errors.New("push subscription expired")
+
+func sendPush(sub *PushSubscription, payload []byte) error {
+	body, err := encryptPushPayload(sub, payload)
+	if err != nil {
+		return err
+	}
+	authorization, err := vapidAuthorization(sub.Endpoint)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest(http.MethodPost, sub.Endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", authorization)
+	req.Header.Set("Content-Encoding", "aes128gcm")
+	req.Header.Set("Content-Type", "application/octet-stream")
+	req.Header.Set("TTL", fmt.Sprint(pushTTLSeconds))
+	resp, err := pushClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 4096))
+	switch {
+	case resp.StatusCode == http.StatusNotFound || resp.StatusCode == http.StatusGone:
+		return errPushGone
+	case resp.StatusCode >= 300:
+		return fmt.Errorf("push service answered %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// PushMessage is the decrypted payload the service worker (sw.js) turns into a notification
+type PushMessage struct {
+	Title     string `json:"title"`
+	Body      string `json:"body"`
+	URL       string `json:"url"`
+	LaporanID int    `json:"laporan_id"`
+}
+
+func runPushWorker() {
+	for {
+		n, err := pushPendingEvents()
+		if err != nil {
+			log.Println("[PUSH ERROR] Delivery round failed:", err)
+		}
+		if err != nil || n < pushBatchSize {
+			select {
+			case <-pushWake:
+			case <-time.After(notifyPollInterval):
+			}
+		}
+	}
+}
+
+// wakePush is called for every laporan_events notification
+func wakePush() {
+	select {
+	case pushWake <- struct{}{}:
+	default:
+	}
+}
+
+// pushPendingEvents pushes a batch of laporan_events to the owners' browsers. Claiming
+// rows with SKIP LOCKED and stamping pushed_at makes each event go out from one replica.
+// The claim commits before anything is sent, so slow push services never hold row
+// locks. A failed push is not retried; the event is still visible in laporan.html.
+func pushPendingEvents() (int, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.Query(`
+		SELECT id, laporan_id, user_nik, event_type, data
+		FROM laporan_events
+		WHERE pushed_at IS NULL
+		ORDER BY id
+		LIMIT $1
+		FOR UPDATE SKIP LOCKED
+	`, pushBatchSize)
+	if err != nil {
+		return 0, err
+	}
+	type pending struct {
+		ID        int64
+		LaporanID int
+		UserNik   string
+		Type      string
+		Data      emailData
+		Actor     string
+	}
+	var batch []pending
+	var ids []int64
+	for rows.Next() {
+		var e pending
+		var data []byte
+		if err := rows.Scan(&e.ID, &e.LaporanID, &e.UserNik, &e.Type, &data); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		var extra struct {
+			ActorType string `json:"actor_type"`
+		}
+		json.Unmarshal(data, &e.Data)
+		json.Unmarshal(data, &extra)
+		e.Actor = extra.ActorType
+		batch = append(batch, e)
+		ids = append(ids, e.ID)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+	if len(batch) == 0 {
+		return 0, nil
+	}
+	if _, err := tx.Exec(`UPDATE laporan_events SET pushed_at = CURRENT_TIMESTAMP WHERE id = ANY($1)`, pq.Array(ids)); err != nil {
+		return 0, err
+	}
+	if err := tx.Commit(); err != nil {
+		return 0, err
+	}
+
+	for _, e := range batch {
+		// Reporters are not pushed about their own withdrawals
+		if e.Type == "status" && e.Actor == "warga" {
+			continue
+		}
+		if err := pushEvent(e.UserNik, e.Type, e.Data); err != nil {
+			log.Println("[PUSH ERROR] Event not pushed:", err)
+		}
+	}
+	return len(batch), nil
+}
+
+// pushEvent sends one event to every subscription of nik, in the reporter's email
+// locale, and drops subscriptions the push service reports as gone
+func pushEvent(nik, eventType string, data emailData) error {
+	prefs, err := loadNotificationPreferences(db, nik)
+	if err != nil {
+		return err
+	}
+	if err := db.QueryRow(`SELECT title FROM laporan WHERE id = $1`, data.LaporanID).Scan(&data.Title); err != nil {
+		return err
+	}
+	template := notifyStatus
+	if eventType == "comment" {
+		template = notifyReply
+	}
+	title, body, err := renderEmail(prefs.Locale, template, data)
+	if err != nil {
+		return err
+	}
+	payload, _ := json.Marshal(PushMessage{Title: title, Body: body, URL: "/laporan.html", LaporanID: data.LaporanID})
+	if len(payload) > maxPushPayload {
+		payload, _ = json.Marshal(PushMessage{Title: title, URL: "/laporan.html", LaporanID: data.LaporanID})
+	}
+
+	rows, err := db.Query(`SELECT endpoint, p256dh, auth FROM push_subscriptions WHERE user_nik = $1`, nik)
+	if err != nil {
+		return err
+	}
+	var subs []PushSubscription
+	for rows.Next() {
+		var s PushSubscription
+		if err := rows.Scan(&s.Endpoint, &s.Keys.P256dh, &s.Keys.Auth); err != nil {
+			rows.Close()
+			return err
+		}
+		subs = append(subs, s)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for i := range subs {
+		err := sendPush(&subs[i], payload)
+		switch {
+		case errors.Is(err, errPushGone):
+			log.Println("[PUSH] Dropping expired subscription")
+			if _, err := db.Exec(`DELETE FROM push_subscriptions WHERE endpoint = $1`, subs[i].Endpoint); err != nil {
+				return err
+			}
+		case err != nil:
+			log.Println("[PUSH ERROR] Send failed:", err)
+		default:
+			if _, err := db.Exec(`UPDATE push_subscriptions SET last_used_at = CURRENT_TIMESTAMP WHERE endpoint = $1`, subs[i].Endpoint); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,266 @@
+package main
+
+import (
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Quotas on report creation, counted in fixed windows: per warga, per warga and divisi,
+// and per client IP. Trusted accounts (users.trusted in the warga database, e.g. RT
+// officials) get their own, higher per-warga quotas and no IP quota, since they often
+// report from a shared connection. Anonim reports carry neither an account nor an
+// address and are bounded by the anonim token allowance instead.
+
+// rateLimitQuota allows Limit requests per Window; a zero Limit disables it
+type rateLimitQuota struct {
+	Limit  int
+	Window time.Duration
+}
+
+// parseRateLimitQuota reads "N/duration", e.g. "10/1h"; an empty string disables the quota
+func parseRateLimitQuota(name, fallback string) (rateLimitQuota, error) {
+	s := strings.TrimSpace(getEnv(name, fallback))
+	if s == "" || s == "0" {
+		return rateLimitQuota{}, nil
+	}
+	count, window, ok := strings.Cut(s, "/")
+	limit, err := strconv.Atoi(count)
+	if !ok || err != nil || limit < 0 {
+		return rateLimitQuota{}, fmt.Errorf("invalid %s: want N/duration, e.g. 10/1h", name)
+	}
+	d, err := parseDuration(window)
+	if err != nil || d < time.Second {
+		return rateLimitQuota{}, fmt.Errorf("invalid %s: want N/duration, e.g. 10/1h", name)
+	}
+	return rateLimitQuota{Limit: limit, Window: d}, nil
+}
+
+// rateLimitStore counts hits per key in fixed windows aligned to the Unix epoch.
+// Every replica must see the same counts, so production uses postgresRateLimitStore.
+type rateLimitStore interface {
+	// Hit records one hit on key in the window containing now and returns the
+	// number of hits in that window so far, including this one
+	Hit(key string, window time.Duration, now time.Time) (int, error)
+}
+
+// rateLimitWindow returns the start and end of the fixed window containing now, in Unix seconds
+func rateLimitWindow(window time.Duration, now time.Time) (start, end int64) {
+	secs := int64(window / time.Second)
+	start = now.Unix() - now.Unix()%secs
+	return start, start + secs
+}
+
+// postgresRateLimitStore keeps counters in rate_limit_counters, shared by all replicas
+type postgresRateLimitStore struct {
+	db *sql.DB
+}
+
+func (s *postgresRateLimitStore) Hit(key string, window time.Duration, now time.Time) (int, error) {
+	start, end := rateLimitWindow(window, now)
+	var hits int
+	err := s.db.QueryRow(`
+		INSERT INTO rate_limit_counters (bucket_key, window_start, window_end, hits)
+		VALUES ($1, $2, $3, 1)
+		ON CONFLICT (bucket_key, window_start) DO UPDATE SET hits = rate_limit_counters.hits + 1
+		RETURNING hits
+	`, key, start, end).Scan(&hits)
+	return hits, err
+}
+
+func (s *postgresRateLimitStore) prune() {
+	for {
+		result, err := s.db.Exec(`DELETE FROM rate_limit_counters WHERE window_end < $1`, time.Now().Unix())
+		if err != nil {
+			log.Println("[RATE LIMIT ERROR] Prune failed:", err)
+		} else if n, _ := result.RowsAffected(); n > 0 {
+			log.Printf("[RATE LIMIT] Pruned %d expired counters\n", n)
+		}
+		time.Sleep(time.Hour)
+	}
+}
+
+// memoryRateLimitStore keeps counters in this process only. It is meant for tests and
+// single-replica setups; with several replicas each one enforces its own count.
+type memoryRateLimitStore struct {
+	sync.Mutex
+	counters map[string]memoryRateLimitCounter
+}
+
+type memoryRateLimitCounter struct {
+	Start, End int64
+	Hits       int
+}
+
+const memoryRateLimitMaxEntries = 10000
+
+func newMemoryRateLimitStore() *memoryRateLimitStore {
+	return &memoryRateLimitStore{counters: map[string]memoryRateLimitCounter{}}
+}
+
+func (s *memoryRateLimitStore) Hit(key string, window time.Duration, now time.Time) (int, error) {
+	start, end := rateLimitWindow(window, now)
+	s.Lock()
+	defer s.Unlock()
+	if len(s.counters) >= memoryRateLimitMaxEntries {
+		for k, c := range s.counters {
+			if c.End <= now.Unix() {
+				delete(s.counters, k)
+			}
+		}
+	}
+	c := s.counters[key]
+	if c.Start != start {
+		c = memoryRateLimitCounter{Start: start, End: end}
+	}
+	c.Hits++
+	s.counters[key] = c
+	return c.Hits, nil
+}
+
+// Set from RATE_LIMIT_STORE and the RATE_LIMIT_* quotas
+var rateLimits rateLimitStore
+var rateLimitUser, rateLimitUserDivisi, rateLimitIP rateLimitQuota
+var rateLimitTrustedUser, rateLimitTrustedUserDivisi rateLimitQuota
+
+func initRateLimits() error {
+	quotas := []struct {
+		dst            *rateLimitQuota
+		name, fallback string
+	}{
+		{&rateLimitUser, "RATE_LIMIT_USER", "10/1h"},
+		{&rateLimitUserDivisi, "RATE_LIMIT_USER_DIVISI", "5/1h"},
+		{&rateLimitIP, "RATE_LIMIT_IP", "30/1h"},
+		{&rateLimitTrustedUser, "RATE_LIMIT_TRUSTED_USER", "100/1h"},
+		{&rateLimitTrustedUserDivisi, "RATE_LIMIT_TRUSTED_USER_DIVISI", "50/1h"},
+	}
+	for _, q := range quotas {
+		var err error
+		if *q.dst, err = parseRateLimitQuota(q.name, q.fallback); err != nil {
+			return err
+		}
+	}
+
+	switch store := getEnv("RATE_LIMIT_STORE", "postgres"); store {
+	case "postgres":
+		pg := &postgresRateLimitStore{db: db}
+		go pg.prune()
+		rateLimits = pg
+	case "memory":
+		log.Println("[RATE LIMIT] Using in-memory counters; each replica counts separately")
+		rateLimits = newMemoryRateLimitStore()
+	default:
+		return fmt.Errorf("invalid RATE_LIMIT_STORE %q: must be postgres or memory", store)
+	}
+	return nil
+}
+
+// isTrustedReporter looks the warga up in the auth database. Lookup failures count
+// as not trusted, so they only ever mean the standard quotas.
+func isTrustedReporter(nik string) bool {
+	var trusted bool
+	if err := authDB.QueryRow(`SELECT trusted FROM users WHERE nik = $1`, nik).Scan(&trusted); err != nil {
+		if !errors.Is(err, sql.ErrNoRows) {
+			log.Println("[RATE LIMIT ERROR] Trusted lookup failed:", err)
+		}
+		return false
+	}
+	return trusted
+}
+
+// clientIP is the address the ingress saw the request come from
+func clientIP(r *http.Request) string {
+	if ip := strings.TrimSpace(r.Header.Get("X-Real-IP")); ip != "" {
+		return ip
+	}
+	if forwarded := r.Header.Get("X-Forwarded-For"); forwarded != "" {
+		first, _, _ := strings.Cut(forwarded, ",")
+		return strings.TrimSpace(first)
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// checkReportRateLimits counts a report creation against every quota that applies and
+// sets the RateLimit-* headers for the most constrained one. When a quota is used up
+// it writes the 429 response and returns false. Store errors let the request through.
+// trusted comes from isTrustedReporter.
+func checkReportRateLimits(w http.ResponseWriter, r *http.Request, userNIK, divisi string, trusted bool) bool {
+	userQuota, divisiQuota, ipQuota := rateLimitUser, rateLimitUserDivisi, rateLimitIP
+	if trusted {
+		userQuota, divisiQuota, ipQuota = rateLimitTrustedUser, rateLimitTrustedUserDivisi, rateLimitQuota{}
+	}
+	type bucket struct {
+		Key   string
+		Quota rateLimitQuota
+	}
+	var buckets []bucket
+	if userQuota.Limit > 0 {
+		buckets = append(buckets, bucket{"user:" + userNIK, userQuota})
+	}
+	if divisiQuota.Limit > 0 {
+		buckets = append(buckets, bucket{"user-divisi:" + userNIK + ":" + divisi, divisiQuota})
+	}
+	if ip := clientIP(r); ipQuota.Limit > 0 && ip != "" {
+		// Addresses are only kept hashed
+		sum := sha256.Sum256([]byte(ip))
+		buckets = append(buckets, bucket{"ip:" + hex.EncodeToString(sum[:16]), ipQuota})
+	}
+	if len(buckets) == 0 {
+		return true
+	}
+
+	now := time.Now()
+	var policies []string
+	var tightest rateLimitQuota
+	tightestRemaining, tightestReset := -1, int64(0)
+	exceeded, retryAfter := false, int64(0)
+	for _, b := range buckets {
+		hits, err := rateLimits.Hit(b.Key, b.Quota.Window, now)
+		if err != nil {
+			log.Println("[RATE LIMIT ERROR] Counter update failed:", err)
+			return true
+		}
+		_, end := rateLimitWindow(b.Quota.Window, now)
+		reset := end - now.Unix()
+		remaining := b.Quota.Limit - hits
+		if remaining < 0 {
+			remaining = 0
+		}
+		if hits > b.Quota.Limit {
+			exceeded = true
+			if reset > retryAfter {
+				retryAfter = reset
+			}
+		}
+		if tightestRemaining < 0 || remaining < tightestRemaining || (remaining == tightestRemaining && reset > tightestReset) {
+			tightest, tightestRemaining, tightestReset = b.Quota, remaining, reset
+		}
+		policies = append(policies, fmt.Sprintf("%d;w=%d", b.Quota.Limit, int64(b.Quota.Window/time.Second)))
+	}
+
+	w.Header().Set("RateLimit-Policy", strings.Join(policies, ", "))
+	w.Header().Set("RateLimit-Limit", strconv.Itoa(tightest.Limit))
+	w.Header().Set("RateLimit-Remaining", strconv.Itoa(tightestRemaining))
+	w.Header().Set("RateLimit-Reset", strconv.FormatInt(tightestReset, 10))
+	if exceeded {
+		log.Printf("[CREATE LAPORAN] Rate limit reached for warga %s\n", userNIK)
+		w.Header().Set("Retry-After", strconv.FormatInt(retryAfter, 10))
+		writeError(w, http.StatusTooManyRequests, ErrCodeRateLimited,
+			fmt.Sprintf("Too many reports, try again in %s", (time.Duration(retryAfter)*time.Second).String()))
+		return false
+	}
+	return true
+}
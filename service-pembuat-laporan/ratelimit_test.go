@@ -0,0 +1,204 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// useTestRateLimits swaps in an in-memory store and the given quotas for one test
+func useTestRateLimits(t *testing.T, user, userDivisi, ip, trustedUser, trustedUserDivisi rateLimitQuota) {
+	t.Helper()
+	saved := []rateLimitQuota{rateLimitUser, rateLimitUserDivisi, rateLimitIP, rateLimitTrustedUser, rateLimitTrustedUserDivisi}
+	savedStore := rateLimits
+	t.Cleanup(func() {
+		rateLimitUser, rateLimitUserDivisi, rateLimitIP = saved[0], saved[1], saved[2]
+		rateLimitTrustedUser, rateLimitTrustedUserDivisi = saved[3], saved[4]
+		rateLimits = savedStore
+	})
+	rateLimitUser, rateLimitUserDivisi, rateLimitIP = user, userDivisi, ip
+	rateLimitTrustedUser, rateLimitTrustedUserDivisi = trustedUser, trustedUserDivisi
+	rateLimits = newMemoryRateLimitStore()
+}
+
+type rateLimitedReport struct {
+	NIK, Divisi, IP string
+	Trusted         bool
+}
+
+func (rep rateLimitedReport) check(t *testing.T) (*httptest.ResponseRecorder, bool) {
+	t.Helper()
+	req := httptest.NewRequest(http.MethodPost, "/laporan", nil)
+	req.Header.Set("X-Real-IP", rep.IP)
+	rec := httptest.NewRecorder()
+	return rec, checkReportRateLimits(rec, req, rep.NIK, rep.Divisi, rep.Trusted)
+}
+
+func TestCheckReportRateLimits(t *testing.T) {
+	// One warga on one address, reporting to the given divisi in turn
+	reports := func(trusted bool, divisi ...string) []rateLimitedReport {
+		var list []rateLimitedReport
+		for _, d := range divisi {
+			list = append(list, rateLimitedReport{NIK: "3171011505900001", Divisi: d, IP: "203.0.113.7", Trusted: trusted})
+		}
+		return list
+	}
+	// n different warga sharing one address
+	neighbours := func(n int) []rateLimitedReport {
+		var list []rateLimitedReport
+		for i := 0; i < n; i++ {
+			list = append(list, rateLimitedReport{NIK: fmt.Sprintf("31710115059%05d", i), Divisi: "kebersihan", IP: "198.51.100.1"})
+		}
+		return list
+	}
+	const standardPolicy = "5;w=3600, 2;w=3600, 10;w=3600"
+	const trustedPolicy = "10;w=3600, 4;w=3600"
+
+	cases := []struct {
+		name          string
+		reports       []rateLimitedReport // the last one is checked
+		wantAllowed   bool
+		wantPolicy    string
+		wantLimit     string
+		wantRemaining string
+	}{
+		{"first report shows the tightest bucket", reports(false, "kebersihan"), true, standardPolicy, "2", "1"},
+		{"divisi quota used up", reports(false, "kebersihan", "kebersihan", "kebersihan"), false, standardPolicy, "2", "0"},
+		{"another divisi is counted separately", reports(false, "kebersihan", "kebersihan", "kesehatan"), true, standardPolicy, "2", "1"},
+		{"warga quota spans every divisi",
+			reports(false, "kebersihan", "kebersihan", "kesehatan", "kesehatan", "fasilitas umum", "kriminalitas"), false, standardPolicy, "5", "0"},
+		{"IP quota is shared by every warga on the address", neighbours(11), false, standardPolicy, "10", "0"},
+		{"trusted warga get their own quotas and no IP quota",
+			reports(true, "kebersihan", "kebersihan", "kebersihan", "kesehatan", "kesehatan", "kesehatan"), true, trustedPolicy, "4", "1"},
+		{"trusted divisi quota still applies",
+			reports(true, "kebersihan", "kebersihan", "kebersihan", "kebersihan", "kebersihan"), false, trustedPolicy, "4", "0"},
+	}
+	hour := func(n int) rateLimitQuota { return rateLimitQuota{Limit: n, Window: time.Hour} }
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			useTestRateLimits(t, hour(5), hour(2), hour(10), hour(10), hour(4))
+			var rec *httptest.ResponseRecorder
+			var allowed bool
+			for _, rep := range tc.reports {
+				rec, allowed = rep.check(t)
+			}
+
+			if allowed != tc.wantAllowed {
+				t.Fatalf("allowed = %v, want %v", allowed, tc.wantAllowed)
+			}
+			h := rec.Header()
+			if got := h.Get("RateLimit-Policy"); got != tc.wantPolicy {
+				t.Errorf("RateLimit-Policy = %q, want %q", got, tc.wantPolicy)
+			}
+			if got := h.Get("RateLimit-Limit"); got != tc.wantLimit {
+				t.Errorf("RateLimit-Limit = %q, want %q", got, tc.wantLimit)
+			}
+			if got := h.Get("RateLimit-Remaining"); got != tc.wantRemaining {
+				t.Errorf("RateLimit-Remaining = %q, want %q", got, tc.wantRemaining)
+			}
+			if reset, err := strconv.Atoi(h.Get("RateLimit-Reset")); err != nil || reset < 1 || reset > 3600 {
+				t.Errorf("RateLimit-Reset = %q, want 1..3600", h.Get("RateLimit-Reset"))
+			}
+
+			if tc.wantAllowed {
+				if rec.Code != http.StatusOK || h.Get("Retry-After") != "" {
+					t.Errorf("allowed request got status %d, Retry-After %q", rec.Code, h.Get("Retry-After"))
+				}
+				return
+			}
+			if rec.Code != http.StatusTooManyRequests {
+				t.Fatalf("status = %d, want 429", rec.Code)
+			}
+			if retry, err := strconv.Atoi(h.Get("Retry-After")); err != nil || retry < 1 || retry > 3600 {
+				t.Errorf("Retry-After = %q, want 1..3600", h.Get("Retry-After"))
+			}
+			var body ErrorResponse
+			if err := json.NewDecoder(rec.Body).Decode(&body); err != nil || body.Error.Code != ErrCodeRateLimited {
+				t.Errorf("body = %+v (%v), want code %s", body, err, ErrCodeRateLimited)
+			}
+		})
+	}
+}
+
+func TestCheckReportRateLimitsTieGoesToLaterReset(t *testing.T) {
+	// Both buckets have one report left; the one that resets later is the binding one
+	useTestRateLimits(t, rateLimitQuota{Limit: 2, Window: time.Minute}, rateLimitQuota{Limit: 2, Window: 24 * time.Hour},
+		rateLimitQuota{}, rateLimitQuota{}, rateLimitQuota{})
+	_, dayEnd := rateLimitWindow(24*time.Hour, time.Now())
+	rec, allowed := rateLimitedReport{NIK: "3171011505900001", Divisi: "kebersihan"}.check(t)
+	if !allowed {
+		t.Fatal("first report refused")
+	}
+	reset, _ := strconv.ParseInt(rec.Header().Get("RateLimit-Reset"), 10, 64)
+	if want := dayEnd - time.Now().Unix(); reset < want-1 || reset > want+1 {
+		t.Errorf("RateLimit-Reset = %d, want the daily window's %d", reset, want)
+	}
+	if got := rec.Header().Get("RateLimit-Policy"); got != "2;w=60, 2;w=86400" {
+		t.Errorf("RateLimit-Policy = %q", got)
+	}
+}
+
+func TestCheckReportRateLimitsDisabled(t *testing.T) {
+	useTestRateLimits(t, rateLimitQuota{}, rateLimitQuota{}, rateLimitQuota{}, rateLimitQuota{}, rateLimitQuota{})
+	rec, allowed := rateLimitedReport{NIK: "3171011505900001", Divisi: "kebersihan", IP: "203.0.113.7"}.check(t)
+	if !allowed || rec.Header().Get("RateLimit-Policy") != "" {
+		t.Errorf("allowed = %v, RateLimit-Policy = %q; want no limits", allowed, rec.Header().Get("RateLimit-Policy"))
+	}
+}
+
+func TestMemoryRateLimitStoreFixedWindows(t *testing.T) {
+	store := newMemoryRateLimitStore()
+	start := time.Unix(1_700_000_400, 0) // a whole number of minutes since the epoch
+	hits := []struct {
+		at   time.Duration
+		want int
+	}{
+		{0, 1},
+		{30 * time.Second, 2},
+		{59 * time.Second, 3},
+		{60 * time.Second, 1}, // next window
+		{119 * time.Second, 2},
+		{5 * time.Minute, 1},
+	}
+	for _, h := range hits {
+		got, err := store.Hit("user:3171011505900001", time.Minute, start.Add(h.at))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != h.want {
+			t.Errorf("hit at +%s = %d, want %d", h.at, got, h.want)
+		}
+	}
+	if got, _ := store.Hit("user:3171011505900002", time.Minute, start.Add(5*time.Minute)); got != 1 {
+		t.Errorf("another key shares the count: %d", got)
+	}
+}
+
+func TestParseRateLimitQuota(t *testing.T) {
+	cases := []struct {
+		value   string
+		want    rateLimitQuota
+		wantErr bool
+	}{
+		{"10/1h", rateLimitQuota{Limit: 10, Window: time.Hour}, false},
+		{"5/30m", rateLimitQuota{Limit: 5, Window: 30 * time.Minute}, false},
+		{" 100/1d ", rateLimitQuota{Limit: 100, Window: 24 * time.Hour}, false},
+		{"0", rateLimitQuota{}, false},
+		{"10", rateLimitQuota{}, true},
+		{"x/1h", rateLimitQuota{}, true},
+		{"-1/1h", rateLimitQuota{}, true},
+		{"10/0s", rateLimitQuota{}, true},
+		{"10/soon", rateLimitQuota{}, true},
+	}
+	for _, tc := range cases {
+		t.Setenv("RATE_LIMIT_TEST", tc.value)
+		got, err := parseRateLimitQuota("RATE_LIMIT_TEST", "99/1h")
+		if (err != nil) != tc.wantErr || got != tc.want {
+			t.Errorf("%q: got %+v, %v; want %+v, error %v", tc.value, got, err, tc.want, tc.wantErr)
+		}
+	}
+}
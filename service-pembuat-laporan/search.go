@@ -0,0 +1,44 @@
+package main
+
+import (
+	"html"
+	"strings"
+)
+
+// Text search configuration used for laporan.search_vector (Snowball Indonesian
+// stemmer, so "perbaikan" matches "diperbaiki" and "jalan" matches "jalanan")
+const searchConfig = "indonesian"
+
+// Longest accepted ?q= value, in characters
+const maxSearchQueryLength = 200
+
+// ts_headline marks matches with these control characters so the surrounding
+// user text can be HTML-escaped before they are turned into <mark> tags
+const (
+	highlightStart = "\x02"
+	highlightStop  = "\x03"
+)
+
+// ts_headline options: short fragments for the description snippet,
+// the whole (short) title for the highlighted title
+const (
+	snippetHeadlineOptions = "StartSel=" + highlightStart + ", StopSel=" + highlightStop + ", MaxFragments=2, MaxWords=25, MinWords=8, FragmentDelimiter=\" … \""
+	titleHeadlineOptions   = "StartSel=" + highlightStart + ", StopSel=" + highlightStop + ", HighlightAll=true"
+)
+
+// searchQuery returns the tsquery expression for q, registering q as a query argument
+func searchQuery(q string, arg func(interface{}) string) string {
+	return "websearch_to_tsquery('" + searchConfig + "', " + arg(q) + ")"
+}
+
+// headline returns the SQL ts_headline expression for column
+func headline(column, tsQuery, options string, arg func(interface{}) string) string {
+	return "ts_headline('" + searchConfig + "', " + column + ", " + tsQuery + ", " + arg(options) + ")"
+}
+
+// highlightHTML escapes a ts_headline result and turns its match markers into <mark> tags
+func highlightHTML(s string) string {
+	s = html.EscapeString(s)
+	s = strings.ReplaceAll(s, highlightStart, "<mark>")
+	return strings.ReplaceAll(s, highlightStop, "</mark>")
+}
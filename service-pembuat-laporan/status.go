@@ -0,0 +1,47 @@
+package main
+
+import "strings"
+
+// Canonical report statuses. These mirror status_laporan_enum in the database and
+// the list in service-penerima-laporan; keep all three in sync.
+const (
+	statusPending   = "pending"
+	statusVerified  = "verified"
+	statusDiproses  = "diproses"
+	statusSelesai   = "selesai"
+	statusDitolak   = "ditolak"
+	statusWithdrawn = "withdrawn" // set by the owner; stays in the DB but leaves public listings
+)
+
+// laporanStatuses lists every status in lifecycle order
+var laporanStatuses = []string{statusPending, statusVerified, statusDiproses, statusSelesai, statusDitolak, statusWithdrawn}
+
+var validStatus = func() map[string]bool {
+	m := make(map[string]bool, len(laporanStatuses))
+	for _, s := range laporanStatuses {
+		m[s] = true
+	}
+	return m
+}()
+
+// statusTransitions lists the statuses a report may move to from each status.
+// selesai, ditolak and withdrawn are final. The database enforces the same rules
+// with the enforce_laporan_status_transition trigger.
+var statusTransitions = map[string][]string{
+	statusPending:  {statusVerified, statusDiproses, statusDitolak, statusWithdrawn},
+	statusVerified: {statusDiproses, statusDitolak},
+	statusDiproses: {statusSelesai, statusDitolak},
+}
+
+// canTransition reports whether a report in status from may move to status to
+func canTransition(from, to string) bool {
+	for _, next := range statusTransitions[from] {
+		if next == to {
+			return true
+		}
+	}
+	return false
+}
+
+// statusList is the human-readable list used in STATUS_INVALID messages
+var statusList = strings.Join(laporanStatuses, ", ")
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// StatusChange is one entry of a report's status timeline (laporan_status_history).
+// Rows are written by a database trigger, so changes made by any service show up here.
+type StatusChange struct {
+	FromStatus *string   `json:"from_status"` // null for the initial status
+	ToStatus   string    `json:"to_status"`
+	ActorType  string    `json:"actor_type"` // warga, admin or system
+	Note       *string   `json:"note,omitempty"`
+	CreatedAt  time.Time `json:"created_at"`
+	// Seconds the report stayed in ToStatus; omitted for the current status
+	DurationSeconds *int64 `json:"duration_seconds,omitempty"`
+}
+
+// setStatusActor tells the status history trigger who is making the change in tx
+func setStatusActor(tx *sql.Tx, actorType, note string) error {
+	_, err := tx.Exec(`SELECT set_config('laporan.actor_type', $1, true), set_config('laporan.status_note', $2, true)`, actorType, note)
+	return err
+}
+
+// loadStatusHistory returns the timeline of each report in ids, oldest change first
+func loadStatusHistory(ids []int) (map[int][]StatusChange, error) {
+	history := make(map[int][]StatusChange, len(ids))
+	if len(ids) == 0 {
+		return history, nil
+	}
+
+	rows, err := db.Query(`
+		SELECT laporan_id, from_status, to_status, actor_type, note, created_at
+		FROM laporan_status_history
+		WHERE laporan_id = ANY($1)
+		ORDER BY laporan_id, created_at, id
+	`, pq.Array(ids))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var laporanID int
+		var c StatusChange
+		if err := rows.Scan(&laporanID, &c.FromStatus, &c.ToStatus, &c.ActorType, &c.Note, &c.CreatedAt); err != nil {
+			return nil, err
+		}
+		if prev := history[laporanID]; len(prev) > 0 {
+			seconds := int64(c.CreatedAt.Sub(prev[len(prev)-1].CreatedAt) / time.Second)
+			prev[len(prev)-1].DurationSeconds = &seconds
+		}
+		history[laporanID] = append(history[laporanID], c)
+	}
+	return history, rows.Err()
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+)
+
+// SupportResponse is returned by PUT and DELETE /laporan/{id}/support
+type SupportResponse struct {
+	SupportCount int  `json:"support_count"`
+	Supported    bool `json:"supported"`
+}
+
+// hasSupported reports whether the warga with this NIK supports the laporan
+func hasSupported(laporanID int, nik string) (bool, error) {
+	var supported bool
+	err := db.QueryRow(`SELECT EXISTS (SELECT 1 FROM laporan_supports WHERE laporan_id = $1 AND voter_nik = $2)`,
+		laporanID, nik).Scan(&supported)
+	return supported, err
+}
+
+// PUT /laporan/{id}/support - "Saya juga mengalami": add the caller's vote (idempotent)
+// DELETE /laporan/{id}/support - Take the vote back (idempotent)
+// Only publik reports can be supported, and never by their own reporter. Voter NIKs
+// are stored in laporan_supports only; responses carry nothing but the count.
+func supportLaporanHandler(w http.ResponseWriter, r *http.Request, laporanID int) {
+	support := r.Method == http.MethodPut
+	tag := "SUPPORT LAPORAN"
+	if !support {
+		tag = "UNSUPPORT LAPORAN"
+	}
+	userNik := r.Header.Get("X-User-NIK")
+
+	tx, err := db.Begin()
+	if err != nil {
+		log.Printf("[%s ERROR] Begin transaction: %v\n", tag, err)
+		writeError(w, http.StatusInternalServerError, ErrCodeInternal, "Failed to update support")
+		return
+	}
+	defer tx.Rollback()
+
+	// Locking the report row serializes concurrent votes on its support_count
+	var tipe, status string
+	var owner sql.NullString
+	var count int
+	err = tx.QueryRow(`SELECT tipe, status, user_nik, support_count FROM laporan WHERE id = $1 FOR UPDATE`, laporanID).
+		Scan(&tipe, &status, &owner, &count)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		log.Printf("[%s ERROR] Database error: %v\n", tag, err)
+		writeError(w, http.StatusInternalServerError, ErrCodeInternal, "Failed to update support")
+		return
+	}
+	if err != nil || tipe != "publik" || status == statusWithdrawn {
+		writeError(w, http.StatusNotFound, ErrCodeLaporanNotFound, "Laporan not found")
+		return
+	}
+	if support && owner.String == userNik {
+		writeError(w, http.StatusConflict, ErrCodeCannotSupportOwnLaporan, "You cannot support your own laporan")
+		return
+	}
+
+	var result sql.Result
+	if support {
+		result, err = tx.Exec(`
+			INSERT INTO laporan_supports (laporan_id, voter_nik) VALUES ($1, $2)
+			ON CONFLICT (laporan_id, voter_nik) DO NOTHING
+		`, laporanID, userNik)
+	} else {
+		result, err = tx.Exec(`DELETE FROM laporan_supports WHERE laporan_id = $1 AND voter_nik = $2`, laporanID, userNik)
+	}
+	if err == nil {
+		if n, _ := result.RowsAffected(); n > 0 {
+			delta := 1
+			if !support {
+				delta = -1
+			}
+			err = tx.QueryRow(`UPDATE laporan SET support_count = support_count + $2 WHERE id = $1 RETURNING support_count`,
+				laporanID, delta).Scan(&count)
+		}
+	}
+	if err == nil {
+		err = tx.Commit()
+	}
+	if err != nil {
+		log.Printf("[%s ERROR] Database error: %v\n", tag, err)
+		writeError(w, http.StatusInternalServerError, ErrCodeInternal, "Failed to update support")
+		return
+	}
+
+	log.Printf("[%s SUCCESS] Laporan %d now has %d supporters\n", tag, laporanID, count)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(SupportResponse{SupportCount: count, Supported: support})
+}
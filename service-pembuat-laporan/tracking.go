@@ -0,0 +1,184 @@
+package main
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base32"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+)
+
+// Header carrying the tracking code of an anonim report. Like the anonim credential it
+// is a header rather than a query param so it never ends up in access logs.
+const trackingCodeHeader = "X-Tracking-Code"
+
+const (
+	trackingCodeBytes     = 20 // 160 bits, 32 base32 characters
+	trackingCodeGroupSize = 4
+)
+
+var trackingCodeEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// newTrackingCode returns a fresh tracking code and the hash stored in its place. The
+// code is shown to the reporter once and never stored, e.g. "K7QM-2XPA-...".
+func newTrackingCode() (code, hash string, err error) {
+	b := make([]byte, trackingCodeBytes)
+	if _, err := rand.Read(b); err != nil {
+		return "", "", err
+	}
+	raw := trackingCodeEncoding.EncodeToString(b)
+	var groups []string
+	for i := 0; i < len(raw); i += trackingCodeGroupSize {
+		groups = append(groups, raw[i:i+trackingCodeGroupSize])
+	}
+	return strings.Join(groups, "-"), hashTrackingCode(raw), nil
+}
+
+// hashTrackingCode normalizes a code as typed by the reporter (any case, with or
+// without dashes and spaces) and returns its SHA-256 in hex. The code carries enough
+// entropy that an unsalted hash cannot be brute-forced. Malformed codes hash to "".
+func hashTrackingCode(code string) string {
+	normalized := strings.Map(func(r rune) rune {
+		if r == '-' || r == ' ' {
+			return -1
+		}
+		return r
+	}, strings.ToUpper(strings.TrimSpace(code)))
+	if b, err := trackingCodeEncoding.DecodeString(normalized); err != nil || len(b) != trackingCodeBytes {
+		return ""
+	}
+	sum := sha256.Sum256([]byte(normalized))
+	return hex.EncodeToString(sum[:])
+}
+
+// trackingCodeOrAuthMiddleware guards routes only the reporter may use. An anonim
+// reporter who sends just a tracking code and no Authorization header gets through
+// without an account; the handler's isOwner check then decides on the code alone.
+func trackingCodeOrAuthMiddleware(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") == "" && r.Header.Get(trackingCodeHeader) != "" {
+			optionalAuthMiddleware(next)(w, r)
+			return
+		}
+		authMiddleware(next)(w, r)
+	}
+}
+
+// GET /laporan/track - The anonim report belonging to the tracking code in
+// X-Tracking-Code, with the same body as GET /laporan/{id}. No account is needed.
+func trackLaporanHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeMethodNotAllowed(w)
+		return
+	}
+	code := r.Header.Get(trackingCodeHeader)
+	if code == "" {
+		writeFieldError(w, http.StatusBadRequest, ErrCodeTrackingCodeRequired, trackingCodeHeader+" header is required", map[string]string{trackingCodeHeader: "required"})
+		return
+	}
+
+	var laporanID int
+	err := db.QueryRow(`SELECT id FROM laporan WHERE tracking_code_hash = $1 AND tipe = 'anonim'`, hashTrackingCode(code)).Scan(&laporanID)
+	if err != nil {
+		if !errors.Is(err, sql.ErrNoRows) {
+			log.Println("[TRACK LAPORAN ERROR] Database error:", err)
+			writeError(w, http.StatusInternalServerError, ErrCodeInternal, "Failed to fetch laporan")
+			return
+		}
+		writeError(w, http.StatusNotFound, ErrCodeLaporanNotFound, "Laporan not found")
+		return
+	}
+	getLaporanDetailHandler(w, r, laporanID)
+}
+
+// TrackingCodeIssued is one report moved to a tracking code by POST /laporan/track/migrate
+type TrackingCodeIssued struct {
+	LaporanID    int    `json:"laporan_id"`
+	Title        string `json:"title"`
+	TrackingCode string `json:"tracking_code"`
+}
+
+// POST /laporan/track/migrate - Opt-in move of the caller's older anonim reports from
+// the client-side NIK+password hash (X-Anonim-Hash) to server-issued tracking codes.
+// Each report gets its own code, returned only in this response. The hash is removed
+// from the report, so afterwards it no longer grants access. The hash is the only
+// credential: no access token is taken, and clients call it on the anonim path, so the
+// account is never seen next to the hash or the ids of its anonim reports.
+func migrateTrackingCodesHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeMethodNotAllowed(w)
+		return
+	}
+	anonHash := r.Header.Get(anonCredentialHeader)
+	if anonHash == "" {
+		writeFieldError(w, http.StatusBadRequest, ErrCodeAnonCredentialRequired, anonCredentialHeader+" header is required", map[string]string{anonCredentialHeader: "required"})
+		return
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		log.Println("[MIGRATE TRACKING ERROR] Begin transaction:", err)
+		writeError(w, http.StatusInternalServerError, ErrCodeInternal, "Failed to migrate laporan")
+		return
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.Query(`
+		SELECT id, title FROM laporan
+		WHERE user_nik = $1 AND tipe = 'anonim' AND tracking_code_hash IS NULL
+		ORDER BY id
+		FOR UPDATE
+	`, anonHash)
+	if err != nil {
+		log.Println("[MIGRATE TRACKING ERROR] Database error:", err)
+		writeError(w, http.StatusInternalServerError, ErrCodeInternal, "Failed to migrate laporan")
+		return
+	}
+	issued := []TrackingCodeIssued{}
+	for rows.Next() {
+		var it TrackingCodeIssued
+		if err := rows.Scan(&it.LaporanID, &it.Title); err != nil {
+			rows.Close()
+			log.Println("[MIGRATE TRACKING ERROR] Scan error:", err)
+			writeError(w, http.StatusInternalServerError, ErrCodeInternal, "Failed to migrate laporan")
+			return
+		}
+		issued = append(issued, it)
+	}
+	rows.Close()
+
+	for i := range issued {
+		code, hash, err := newTrackingCode()
+		if err == nil {
+			_, err = tx.Exec(`UPDATE laporan SET tracking_code_hash = $2, user_nik = NULL WHERE id = $1`, issued[i].LaporanID, hash)
+		}
+		// The reporter's earlier comments stay theirs under the new credential
+		if err == nil {
+			_, err = tx.Exec(`
+				UPDATE laporan_comments SET author_id = $4
+				WHERE laporan_id = $1 AND author_type = $2 AND author_id = $3
+			`, issued[i].LaporanID, commentAuthorReporter, anonHash, hash)
+		}
+		if err != nil {
+			log.Println("[MIGRATE TRACKING ERROR] Database error:", err)
+			writeError(w, http.StatusInternalServerError, ErrCodeInternal, "Failed to migrate laporan")
+			return
+		}
+		issued[i].TrackingCode = code
+	}
+	if err := tx.Commit(); err != nil {
+		log.Println("[MIGRATE TRACKING ERROR] Commit failed:", err)
+		writeError(w, http.StatusInternalServerError, ErrCodeInternal, "Failed to migrate laporan")
+		return
+	}
+
+	logRequestf(r, "[MIGRATE TRACKING SUCCESS] Issued tracking codes for %d anonim laporan\n", len(issued))
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	json.NewEncoder(w).Encode(map[string][]TrackingCodeIssued{"data": issued})
+}
@@ -46,6 +46,28 @@ const JWT_REFRESH_SECRET = process.env.JWT_REFRESH_SECRET || 'your-refresh-secre
 const JWT_ACCESS_EXPIRY = process.env.JWT_ACCESS_EXPIRY || '15m';
 const JWT_REFRESH_EXPIRY = process.env.JWT_REFRESH_EXPIRY || '7d';
 
+// Longest public note an admin can attach to a status change
+const STATUS_NOTE_MAX_LENGTH = 500;
+
+// Canonical report statuses and allowed transitions. These mirror status_laporan_enum and the
+// enforce_laporan_status_transition trigger in the database, and status.go in service-pembuat-laporan.
+// selesai, ditolak and withdrawn are final; withdrawn is only set by the reporter.
+const LAPORAN_STATUSES = ['pending', 'verified', 'diproses', 'selesai', 'ditolak', 'withdrawn'];
+const STATUS_TRANSITIONS = {
+  pending: ['verified', 'diproses', 'ditolak', 'withdrawn'],
+  verified: ['diproses', 'ditolak'],
+  diproses: ['selesai', 'ditolak'],
+  selesai: [],
+  ditolak: [],
+  withdrawn: [],
+};
+// Statuses an admin may set (withdrawn belongs to the reporter)
+const ADMIN_STATUSES = LAPORAN_STATUSES.filter((s) => s !== 'withdrawn');
+
+// Anonim reports stay hidden from officers until their random publication time
+// (ANON_PUBLISH_DELAY_MAX in service-pembuat-laporan)
+const PUBLISHED = '(published_at IS NULL OR published_at <= CURRENT_TIMESTAMP)';
+
 // Password requirements
 const PASSWORD_MIN_LENGTH = 8;
 
@@ -602,7 +624,9 @@ app.get('/laporan', verifyAdminToken, async (req, res) => {
   console.log(`[GET LAPORAN] Request by admin: ${req.user.nama} (Divisi: ${adminDivisi})`);
   try {
     const result = await pool.query(
-      'SELECT id, title, description, tipe, divisi, user_nik, status, created_at, updated_at FROM laporan WHERE divisi = $1 ORDER BY created_at DESC',
+      `SELECT id, title, description, tipe, divisi, user_nik, status, version, support_count, duplicate_of,
+              (SELECT COUNT(*)::int FROM laporan c WHERE c.duplicate_of = l.id) AS duplicate_count, created_at, updated_at
+       FROM laporan l WHERE divisi = $1 AND ${PUBLISHED} ORDER BY created_at DESC`,
       [adminDivisi]
     );
     console.log(`[GET LAPORAN SUCCESS] Retrieved ${result.rows.length} reports for divisi: ${adminDivisi}`);
@@ -613,10 +637,39 @@ app.get('/laporan', verifyAdminToken, async (req, res) => {
   }
 });
 
+// GET /laporan/:id/revisions - Earlier versions of a report edited or withdrawn by its owner (Protected - Admin only)
+app.get('/laporan/:id/revisions', verifyAdminToken, async (req, res) => {
+  const { id } = req.params;
+  const adminDivisi = req.user.divisi;
+  console.log(`[GET REVISIONS] Admin ${req.user.nama} fetching revisions of laporan ${id}`);
+
+  try {
+    // Visible if the report is in the admin's divisi now or was in any earlier version
+    const result = await pool.query(
+      `SELECT r.version, r.title, r.description, r.divisi, r.status, r.change_type, r.created_at
+       FROM laporan_revisions r
+       JOIN laporan l ON l.id = r.laporan_id
+       WHERE r.laporan_id = $1
+         AND (l.divisi = $2 OR EXISTS (SELECT 1 FROM laporan_revisions x WHERE x.laporan_id = l.id AND x.divisi = $2))
+       ORDER BY r.version`,
+      [id, adminDivisi]
+    );
+    res.json(result.rows);
+  } catch (error) {
+    console.error('[GET REVISIONS ERROR] Database error:', error);
+    res.status(500).json({ error: 'Failed to fetch revisions' });
+  }
+});
+
+// GET /laporan/statuses - Status vocabulary and allowed transitions (Protected - Admin only)
+app.get('/laporan/statuses', verifyAdminToken, (req, res) => {
+  res.json({ statuses: LAPORAN_STATUSES, adminStatuses: ADMIN_STATUSES, transitions: STATUS_TRANSITIONS });
+});
+
 // PUT /laporan/:id/status - Update report status (Protected - Admin only)
 app.put('/laporan/:id/status', verifyAdminToken, async (req, res) => {
   const { id } = req.params;
-  const { status } = req.body;
+  const { status, note } = req.body;
   console.log(`[UPDATE STATUS] Admin ${req.user.username} updating laporan ${id} to status: ${status}`);
 
   if (!status) {
@@ -625,32 +678,166 @@ app.put('/laporan/:id/status', verifyAdminToken, async (req, res) => {
   }
 
   // Validate status values
-  const validStatuses = ['pending', 'in_progress', 'completed', 'rejected'];
-  if (!validStatuses.includes(status)) {
+  if (!ADMIN_STATUSES.includes(status)) {
     console.log(`[UPDATE STATUS ERROR] Invalid status value: ${status}`);
     return res.status(400).json({ 
-      error: 'Invalid status. Must be one of: pending, in_progress, completed, rejected' 
+      error: `Invalid status. Must be one of: ${ADMIN_STATUSES.join(', ')}` 
     });
   }
 
+  // Optional note shown to the reporter in the status timeline
+  if (note !== undefined && note !== null && (typeof note !== 'string' || note.length > STATUS_NOTE_MAX_LENGTH)) {
+    console.log('[UPDATE STATUS ERROR] Invalid note');
+    return res.status(400).json({ error: `Note must be a string of at most ${STATUS_NOTE_MAX_LENGTH} characters` });
+  }
+
+  const client = await pool.connect();
   try {
+    await client.query('BEGIN');
+    // Tell the status history trigger who made this change
+    await client.query(
+      "SELECT set_config('laporan.actor_type', 'admin', true), set_config('laporan.status_note', $1, true)",
+      [(note || '').trim()]
+    );
+
     // Only update if the laporan belongs to admin's divisi
     const adminDivisi = req.user.divisi;
-    const result = await pool.query(
-      'UPDATE laporan SET status = $1, updated_at = CURRENT_TIMESTAMP WHERE id = $2 AND divisi = $3 RETURNING *',
-      [status, id, adminDivisi]
+    const current = await client.query(
+      `SELECT status FROM laporan WHERE id = $1 AND divisi = $2 AND ${PUBLISHED} FOR UPDATE`,
+      [id, adminDivisi]
     );
 
-    if (result.rows.length === 0) {
+    if (current.rows.length === 0) {
+      await client.query('ROLLBACK');
       console.log(`[UPDATE STATUS ERROR] Laporan not found or not in admin's divisi: id=${id}, divisi=${adminDivisi}`);
       return res.status(404).json({ error: 'Laporan not found or not in your divisi' });
     }
 
+    const currentStatus = current.rows[0].status;
+    if (currentStatus !== status && !STATUS_TRANSITIONS[currentStatus].includes(status)) {
+      await client.query('ROLLBACK');
+      console.log(`[UPDATE STATUS ERROR] Transition not allowed: ${currentStatus} -> ${status}`);
+      return res.status(409).json({
+        error: `Cannot change status from ${currentStatus} to ${status}`,
+        allowed: STATUS_TRANSITIONS[currentStatus],
+      });
+    }
+
+    // Setting the current status again is a no-op (no history entry is written)
+    const result = await client.query(
+      'UPDATE laporan SET status = $1, updated_at = CASE WHEN status = $1 THEN updated_at ELSE CURRENT_TIMESTAMP END WHERE id = $2 RETURNING id, title, description, tipe, divisi, user_nik, status, created_at, updated_at',
+      [status, id]
+    );
+
+    await client.query('COMMIT');
     console.log(`[UPDATE STATUS SUCCESS] Admin ${req.user.nama} updated laporan ${id} status to: ${status}`);
     res.json(result.rows[0]);
   } catch (error) {
+    await client.query('ROLLBACK').catch(() => {});
     console.error('[UPDATE STATUS ERROR] Database error:', error);
     res.status(500).json({ error: 'Failed to update laporan status' });
+  } finally {
+    client.release();
+  }
+});
+
+// PUT /laporan/:id/duplicate-of - Link a report to the parent it duplicates (Protected - Admin only)
+// Both reports must be in the admin's divisi. Reports already linked to the child move
+// to the parent, and the child's supporters (plus its reporter, unless anonim) are
+// rolled up into the parent's support count when the parent is publik.
+app.put('/laporan/:id/duplicate-of', verifyAdminToken, async (req, res) => {
+  const childId = parseInt(req.params.id, 10);
+  const parentId = parseInt(req.body.parentId, 10);
+  const adminDivisi = req.user.divisi;
+  console.log(`[LINK DUPLICATE] Admin ${req.user.nama} linking laporan ${req.params.id} to ${req.body.parentId}`);
+
+  if (!Number.isInteger(childId) || !Number.isInteger(parentId)) {
+    return res.status(400).json({ error: 'parentId must be a laporan id' });
+  }
+  if (childId === parentId) {
+    return res.status(400).json({ error: 'A laporan cannot be a duplicate of itself' });
+  }
+
+  const client = await pool.connect();
+  try {
+    await client.query('BEGIN');
+    // Lock both rows in id order so concurrent links cannot deadlock
+    const found = await client.query(
+      `SELECT id, tipe, user_nik, duplicate_of FROM laporan WHERE id = ANY($1) AND divisi = $2 AND ${PUBLISHED} ORDER BY id FOR UPDATE`,
+      [[childId, parentId], adminDivisi]
+    );
+    const child = found.rows.find((l) => l.id === childId);
+    const parent = found.rows.find((l) => l.id === parentId);
+    if (!child || !parent) {
+      await client.query('ROLLBACK');
+      console.log(`[LINK DUPLICATE ERROR] Laporan not found or not in admin's divisi: ${childId}, ${parentId}`);
+      return res.status(404).json({ error: 'Laporan not found or not in your divisi' });
+    }
+    if (parent.duplicate_of !== null) {
+      await client.query('ROLLBACK');
+      return res.status(409).json({
+        error: `Laporan ${parentId} is itself a duplicate of ${parent.duplicate_of}`,
+        parentId: parent.duplicate_of,
+      });
+    }
+
+    await client.query('UPDATE laporan SET duplicate_of = $1 WHERE duplicate_of = $2', [parentId, childId]);
+    await client.query('UPDATE laporan SET duplicate_of = $1, updated_at = CURRENT_TIMESTAMP WHERE id = $2', [parentId, childId]);
+
+    if (parent.tipe === 'publik') {
+      await client.query(
+        `INSERT INTO laporan_supports (laporan_id, voter_nik)
+         SELECT $1::int, voter_nik FROM laporan_supports WHERE laporan_id = $2
+         UNION
+         SELECT $1::int, user_nik FROM laporan WHERE id = $2 AND tipe <> 'anonim' AND user_nik IS NOT NULL
+         ON CONFLICT (laporan_id, voter_nik) DO NOTHING`,
+        [parentId, childId]
+      );
+      // The parent's own reporter never counts as a supporter
+      await client.query('DELETE FROM laporan_supports WHERE laporan_id = $1 AND voter_nik = $2', [parentId, parent.user_nik]);
+      await client.query(
+        'UPDATE laporan SET support_count = (SELECT COUNT(*) FROM laporan_supports WHERE laporan_id = $1) WHERE id = $1',
+        [parentId]
+      );
+    }
+
+    const result = await client.query(
+      `SELECT p.id, p.support_count, (SELECT COUNT(*)::int FROM laporan c WHERE c.duplicate_of = p.id) AS duplicate_count
+       FROM laporan p WHERE p.id = $1`,
+      [parentId]
+    );
+    await client.query('COMMIT');
+    console.log(`[LINK DUPLICATE SUCCESS] Laporan ${childId} linked to ${parentId}`);
+    res.json({ id: childId, duplicate_of: parentId, parent: result.rows[0] });
+  } catch (error) {
+    await client.query('ROLLBACK').catch(() => {});
+    console.error('[LINK DUPLICATE ERROR] Database error:', error);
+    res.status(500).json({ error: 'Failed to link duplicate' });
+  } finally {
+    client.release();
+  }
+});
+
+// DELETE /laporan/:id/duplicate-of - Unlink a report from its parent (Protected - Admin only)
+// Supporters already rolled up into the parent stay there.
+app.delete('/laporan/:id/duplicate-of', verifyAdminToken, async (req, res) => {
+  const { id } = req.params;
+  console.log(`[UNLINK DUPLICATE] Admin ${req.user.nama} unlinking laporan ${id}`);
+  try {
+    const result = await pool.query(
+      `UPDATE laporan SET duplicate_of = NULL, updated_at = CURRENT_TIMESTAMP
+       WHERE id = $1 AND divisi = $2 AND duplicate_of IS NOT NULL
+       RETURNING id, duplicate_of`,
+      [id, req.user.divisi]
+    );
+    if (result.rows.length === 0) {
+      return res.status(404).json({ error: 'Linked laporan not found or not in your divisi' });
+    }
+    console.log(`[UNLINK DUPLICATE SUCCESS] Laporan ${id} unlinked`);
+    res.json(result.rows[0]);
+  } catch (error) {
+    console.error('[UNLINK DUPLICATE ERROR] Database error:', error);
+    res.status(500).json({ error: 'Failed to unlink duplicate' });
   }
 });
 
@@ -662,7 +849,7 @@ app.get('/laporan/public', async (req, res) => {
     const result = await pool.query(
       `SELECT id, title, description, divisi, status, created_at, updated_at 
        FROM laporan 
-       WHERE tipe = 'publik'
+       WHERE tipe = 'publik' AND status <> 'withdrawn'
        ORDER BY created_at DESC`
     );
 
@@ -675,50 +862,47 @@ app.get('/laporan/public', async (req, res) => {
 });
 
 // GET /laporan/my - Get user's own reports (Protected - Warga only)
+// NIK always comes from the verified token; the anonim hash is read from the
+// X-Anonim-Hash header so one warga can never query another's reports
 app.get('/laporan/my', verifyWargaToken, async (req, res) => {
-  const { user_nik, user_hash, filter } = req.query;
+  const { filter } = req.query;
+  const userNik = req.user.nik;
+  const userHash = req.get('X-Anonim-Hash');
   console.log(`[GET MY LAPORAN] Warga ${req.user.nik} fetching their reports, filter: ${filter}`);
 
   try {
     let result;
     
-    if (filter === 'nik') {
-      // Only get laporan where user_nik matches (non-anonim reports)
+    if (filter === 'hash') {
+      // Only get anonim laporan where user_nik matches the hash
+      if (!userHash) {
+        return res.status(400).json({ error: 'X-Anonim-Hash header is required for hash filter' });
+      }
       result = await pool.query(
         `SELECT id, title, description, tipe, divisi, status, created_at, updated_at 
          FROM laporan 
-         WHERE user_nik = $1 AND tipe != 'anonim'
+         WHERE user_nik = $1 AND tipe = 'anonim'
          ORDER BY created_at DESC`,
-        [user_nik]
+        [userHash]
       );
-    } else if (filter === 'hash') {
-      // Only get anonim laporan where user_nik matches the hash
+    } else if (filter !== 'nik' && userHash) {
+      // Get all user's reports (both NIK-based and hash-based)
       result = await pool.query(
         `SELECT id, title, description, tipe, divisi, status, created_at, updated_at 
          FROM laporan 
-         WHERE user_nik = $1 AND tipe = 'anonim'
+         WHERE (user_nik = $1 AND tipe != 'anonim') OR (user_nik = $2 AND tipe = 'anonim')
          ORDER BY created_at DESC`,
-        [user_nik]
+        [userNik, userHash]
       );
     } else {
-      // Get all user's reports (both NIK-based and hash-based)
-      if (user_hash) {
-        result = await pool.query(
-          `SELECT id, title, description, tipe, divisi, status, created_at, updated_at 
-           FROM laporan 
-           WHERE (user_nik = $1 AND tipe != 'anonim') OR (user_nik = $2 AND tipe = 'anonim')
-           ORDER BY created_at DESC`,
-          [user_nik, user_hash]
-        );
-      } else {
-        result = await pool.query(
-          `SELECT id, title, description, tipe, divisi, status, created_at, updated_at 
-           FROM laporan 
-           WHERE user_nik = $1 AND tipe != 'anonim'
-           ORDER BY created_at DESC`,
-          [user_nik]
-        );
-      }
+      // Only get laporan where user_nik matches (non-anonim reports)
+      result = await pool.query(
+        `SELECT id, title, description, tipe, divisi, status, created_at, updated_at 
+         FROM laporan 
+         WHERE user_nik = $1 AND tipe != 'anonim'
+         ORDER BY created_at DESC`,
+        [userNik]
+      );
     }
 
     console.log(`[GET MY LAPORAN] Found ${result.rows.length} laporan for user`);
@@ -729,64 +913,6 @@ app.get('/laporan/my', verifyWargaToken, async (req, res) => {
   }
 });
 
-// POST /laporan - Create new report (Protected - Warga only)
-app.post('/laporan', verifyWargaToken, async (req, res) => {
-  const { title, description, tipe, divisi, userNikHash } = req.body;
-  console.log(`[CREATE LAPORAN] Warga ${req.user.nik} creating new laporan`);
-
-  if (!title || !description) {
-    console.log('[CREATE LAPORAN ERROR] Missing title or description');
-    return res.status(400).json({ error: 'Title and description are required' });
-  }
-
-  // Validate tipe enum
-  const validTipe = ['publik', 'private', 'anonim'];
-  if (!validTipe.includes(tipe)) {
-    console.log(`[CREATE LAPORAN ERROR] Invalid tipe: ${tipe}`);
-    return res.status(400).json({ error: 'Tipe must be one of: publik, private, anonim' });
-  }
-
-  // Validate divisi enum
-  const validDivisi = ['kebersihan', 'kesehatan', 'fasilitas umum', 'kriminalitas'];
-  if (!validDivisi.includes(divisi)) {
-    console.log(`[CREATE LAPORAN ERROR] Invalid divisi: ${divisi}`);
-    return res.status(400).json({ error: 'Divisi must be one of: kebersihan, kesehatan, fasilitas umum, kriminalitas' });
-  }
-
-  // Determine user identifier to store
-  // For anonim reports, use the hash provided by frontend (NIK+password hashed client-side)
-  // Server never sees the password - only the hash
-  let userIdentifier;
-  if (tipe === 'anonim') {
-    if (!userNikHash) {
-      console.log('[CREATE LAPORAN ERROR] userNikHash required for anonymous reports');
-      return res.status(400).json({ error: 'Hash NIK+password diperlukan untuk laporan anonim' });
-    }
-    userIdentifier = userNikHash;
-    console.log('[CREATE LAPORAN] Anonim report - using client-side hash');
-  } else {
-    userIdentifier = req.user.nik;
-  }
-
-  try {
-    const result = await pool.query(
-      'INSERT INTO laporan (title, description, tipe, divisi, user_nik, status) VALUES ($1, $2, $3, $4, $5, $6) RETURNING *',
-      [title, description, tipe, divisi, userIdentifier, 'pending']
-    );
-
-    // Log success - hide NIK for anonim reports
-    if (tipe === 'anonim') {
-      console.log(`[CREATE LAPORAN SUCCESS] New ANONIM laporan created with ID: ${result.rows[0].id} (identity protected)`);
-    } else {
-      console.log(`[CREATE LAPORAN SUCCESS] New laporan created by warga ${req.user.nik}: ${result.rows[0].id}`);
-    }
-    res.status(201).json(result.rows[0]);
-  } catch (error) {
-    console.error('[CREATE LAPORAN ERROR] Database error:', error);
-    res.status(500).json({ error: 'Failed to create laporan' });
-  }
-});
-
 // Health check endpoint
 app.get('/health', (req, res) => {
   res.json({ status: 'healthy' });